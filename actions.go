@@ -0,0 +1,58 @@
+package trengin
+
+import "context"
+
+// OpenPosition creates an action to open a position (see NewOpenPositionAction),
+// sends it and waits for the result. If ctx is done earlier,
+// it returns ctx.Err()
+func (a Actions) OpenPosition(
+	ctx context.Context,
+	figi string,
+	positionType PositionType,
+	quantity int64,
+	stopLossOffset float64,
+	takeProfitOffset float64,
+) (OpenPositionActionResult, error) {
+	action := NewOpenPositionAction(figi, positionType, quantity, stopLossOffset, takeProfitOffset)
+	if err := a.send(ctx, action); err != nil {
+		return OpenPositionActionResult{}, err
+	}
+	return action.Result(ctx)
+}
+
+// ClosePosition creates an action to close the position with positionID,
+// sends it and waits for the result. If ctx is done earlier,
+// it returns ctx.Err()
+func (a Actions) ClosePosition(ctx context.Context, positionID PositionID) (ClosePositionActionResult, error) {
+	action := NewClosePositionAction(positionID)
+	if err := a.send(ctx, action); err != nil {
+		return ClosePositionActionResult{}, err
+	}
+	return action.Result(ctx)
+}
+
+// ChangeConditionalOrder creates an action to change conditional orders
+// of the position with positionID (see NewChangeConditionalOrderAction),
+// sends it and waits for the result. If ctx is done earlier, it returns ctx.Err().
+// The callback set by Engine.OnConditionalOrderChanged is invoked as well
+func (a Actions) ChangeConditionalOrder(
+	ctx context.Context,
+	positionID PositionID,
+	stopLoss float64,
+	takeProfit float64,
+) (ChangeConditionalOrderActionResult, error) {
+	action := NewChangeConditionalOrderAction(positionID, stopLoss, takeProfit)
+	if err := a.send(ctx, action); err != nil {
+		return ChangeConditionalOrderActionResult{}, err
+	}
+	return action.Result(ctx)
+}
+
+func (a Actions) send(ctx context.Context, action interface{}) error {
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case a <- action:
+	}
+	return nil
+}
@@ -0,0 +1,109 @@
+package trengin
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestActions_helpers(t *testing.T) {
+	strategy := &MockStrategy{}
+	broker := &MockBroker{}
+	engine := New(strategy, broker)
+
+	position := Position{ID: NewPositionID(), FIGI: "FIGI", Type: Long, Quantity: 2}
+	closedPosition := position
+	closedPosition.ClosePrice = 10
+
+	broker.On("OpenPosition", mock.Anything, mock.MatchedBy(func(a OpenPositionAction) bool {
+		return a.FIGI == "FIGI" && a.Type == Long && a.Quantity == 2 &&
+			a.StopLossOffset == 1 && a.TakeProfitOffset == 3
+	})).Return(position, PositionClosed(make(chan Position)), nil)
+	broker.On("ClosePosition", mock.Anything, mock.MatchedBy(func(a ClosePositionAction) bool {
+		return a.PositionID == position.ID
+	})).Return(closedPosition, nil)
+
+	strategy.On("Run", mock.Anything, mock.Anything).Run(func(args mock.Arguments) {
+		ctx := args.Get(0).(context.Context)
+		actions := args.Get(1).(Actions)
+
+		openResult, err := actions.OpenPosition(ctx, "FIGI", Long, 2, 1, 3)
+		assert.NoError(t, err)
+		assert.Equal(t, position, openResult.Position)
+
+		closeResult, err := actions.ClosePosition(ctx, openResult.Position.ID)
+		assert.NoError(t, err)
+		assert.Equal(t, closedPosition, closeResult.Position)
+		close(actions)
+		<-ctx.Done()
+	}).Return(nil)
+
+	assert.NoError(t, engine.Run(context.Background()))
+	broker.AssertExpectations(t)
+}
+
+func TestActions_ChangeConditionalOrder(t *testing.T) {
+	strategy := &MockStrategy{}
+	broker := &MockBroker{}
+
+	var callbackPosition Position
+	engine := New(strategy, broker).OnConditionalOrderChanged(func(position Position) {
+		callbackPosition = position
+	})
+
+	position := Position{ID: NewPositionID(), StopLoss: 90, TakeProfit: 120}
+	broker.On("ChangeConditionalOrder", mock.Anything, mock.MatchedBy(func(a ChangeConditionalOrderAction) bool {
+		return a.PositionID == position.ID && a.StopLoss == 90 && a.TakeProfit == 120
+	})).Return(position, nil)
+
+	var result ChangeConditionalOrderActionResult
+	strategy.On("Run", mock.Anything, mock.Anything).Run(func(args mock.Arguments) {
+		ctx := args.Get(0).(context.Context)
+		actions := args.Get(1).(Actions)
+
+		var err error
+		result, err = actions.ChangeConditionalOrder(ctx, position.ID, 90, 120)
+		assert.NoError(t, err)
+		close(actions)
+		<-ctx.Done()
+	}).Return(nil)
+
+	assert.NoError(t, engine.Run(context.Background()))
+	assert.Equal(t, position, result.Position)
+	assert.Equal(t, position, callbackPosition)
+}
+
+func TestActions_OpenPosition_brokerError(t *testing.T) {
+	strategy := &MockStrategy{}
+	broker := &MockBroker{}
+	engine := New(strategy, broker)
+
+	expectedErr := errors.New("error")
+	broker.On("OpenPosition", mock.Anything, mock.Anything).Return(Position{}, PositionClosed(nil), expectedErr)
+	strategy.On("Run", mock.Anything, mock.Anything).Run(func(args mock.Arguments) {
+		_, err := args.Get(1).(Actions).OpenPosition(args.Get(0).(context.Context), "FIGI", Long, 1, 0, 0)
+		assert.ErrorIs(t, err, expectedErr)
+		close(args.Get(1).(Actions))
+		<-args.Get(0).(context.Context).Done()
+	}).Return(nil)
+
+	assert.NoError(t, engine.Run(context.Background()))
+}
+
+func TestActions_contextCanceled(t *testing.T) {
+	actions := make(Actions)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, err := actions.OpenPosition(ctx, "FIGI", Long, 1, 0, 0)
+	assert.ErrorIs(t, err, context.Canceled)
+
+	_, err = actions.ClosePosition(ctx, NewPositionID())
+	assert.ErrorIs(t, err, context.Canceled)
+
+	_, err = actions.ChangeConditionalOrder(ctx, NewPositionID(), 1, 2)
+	assert.ErrorIs(t, err, context.Canceled)
+}
@@ -0,0 +1,176 @@
+// Package composite implements trengin.Broker which routes actions
+// to several brokers by instrument. It allows to use brokers
+// which trade a single instrument within one Engine.
+package composite
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/evsamsonov/trengin/v2"
+	"golang.org/x/sync/errgroup"
+)
+
+var ErrUnknownFIGI = errors.New("unknown figi")
+
+var (
+	_ trengin.Broker            = &Broker{}
+	_ trengin.Runner            = &Broker{}
+	_ trengin.ErrorReporter     = &Broker{}
+	_ trengin.ProtectionMonitor = &Broker{}
+)
+
+// Broker routes OpenPositionAction to the broker of the instrument by FIGI.
+// ClosePositionAction and ChangeConditionalOrderAction are routed to the broker
+// which opened the position. Create it with New
+type Broker struct {
+	brokers map[string]trengin.Broker
+
+	mtx       sync.RWMutex
+	positions map[trengin.PositionID]trengin.Broker
+	done      <-chan struct{}
+}
+
+// New creates Broker with the map from FIGI to the broker of the instrument
+func New(brokers map[string]trengin.Broker) *Broker {
+	return &Broker{
+		brokers:   brokers,
+		positions: make(map[trengin.PositionID]trengin.Broker),
+	}
+}
+
+// Run runs the brokers which implement trengin.Runner. It stops if one of them returns an error.
+// If none of the brokers implements trengin.Runner, it waits until ctx is done.
+// Delivery of closed positions stops when ctx is done as well
+func (b *Broker) Run(ctx context.Context) error {
+	b.mtx.Lock()
+	b.done = ctx.Done()
+	b.mtx.Unlock()
+
+	g, ctx := errgroup.WithContext(ctx)
+	var runners int
+	for figi, broker := range b.brokers {
+		figi := figi
+		runner, ok := broker.(trengin.Runner)
+		if !ok {
+			continue
+		}
+		runners++
+		g.Go(func() error {
+			if err := runner.Run(ctx); err != nil {
+				return fmt.Errorf("%s: %w", figi, err)
+			}
+			return nil
+		})
+	}
+	if runners == 0 {
+		<-ctx.Done()
+		return nil
+	}
+	return g.Wait()
+}
+
+// SetErrorHandler passes f to the brokers which implement trengin.ErrorReporter
+func (b *Broker) SetErrorHandler(f func(err error)) {
+	for _, broker := range b.brokers {
+		if reporter, ok := broker.(trengin.ErrorReporter); ok {
+			reporter.SetErrorHandler(f)
+		}
+	}
+}
+
+// SetProtectionLostHandler passes f to the brokers which implement trengin.ProtectionMonitor
+func (b *Broker) SetProtectionLostHandler(f func(position trengin.Position)) {
+	for _, broker := range b.brokers {
+		if monitor, ok := broker.(trengin.ProtectionMonitor); ok {
+			monitor.SetProtectionLostHandler(f)
+		}
+	}
+}
+
+// OpenPosition opens a position by the broker of action.FIGI.
+// It returns ErrUnknownFIGI if there is no broker for the instrument
+func (b *Broker) OpenPosition(
+	ctx context.Context,
+	action trengin.OpenPositionAction,
+) (trengin.Position, trengin.PositionClosed, error) {
+	broker, ok := b.brokers[action.FIGI]
+	if !ok {
+		return trengin.Position{}, nil, fmt.Errorf("%s: %w", action.FIGI, ErrUnknownFIGI)
+	}
+
+	position, closed, err := broker.OpenPosition(ctx, action)
+	if err != nil || closed == nil {
+		return position, closed, err
+	}
+
+	b.mtx.Lock()
+	b.positions[position.ID] = broker
+	done := b.done
+	b.mtx.Unlock()
+
+	// The buffer lets the closed position be delivered without a waiting reader,
+	// the next ones are dropped after Run is stopped
+	out := make(chan trengin.Position, 1)
+	go func() {
+		defer close(out)
+		for p := range closed {
+			b.forget(p.ID)
+			select {
+			case <-done:
+				return
+			case out <- p:
+			}
+		}
+	}()
+	return position, out, nil
+}
+
+// ClosePosition closes a position by the broker which opened it.
+// It returns trengin.ErrPositionNotFound if the position is unknown
+func (b *Broker) ClosePosition(
+	ctx context.Context,
+	action trengin.ClosePositionAction,
+) (trengin.Position, error) {
+	broker, err := b.broker(action.PositionID)
+	if err != nil {
+		return trengin.Position{}, err
+	}
+	position, err := broker.ClosePosition(ctx, action)
+	if err != nil {
+		return position, err
+	}
+	b.forget(action.PositionID)
+	return position, nil
+}
+
+// ChangeConditionalOrder changes conditional orders by the broker which opened the position.
+// It returns trengin.ErrPositionNotFound if the position is unknown
+func (b *Broker) ChangeConditionalOrder(
+	ctx context.Context,
+	action trengin.ChangeConditionalOrderAction,
+) (trengin.Position, error) {
+	broker, err := b.broker(action.PositionID)
+	if err != nil {
+		return trengin.Position{}, err
+	}
+	return broker.ChangeConditionalOrder(ctx, action)
+}
+
+func (b *Broker) broker(positionID trengin.PositionID) (trengin.Broker, error) {
+	b.mtx.RLock()
+	defer b.mtx.RUnlock()
+	broker, ok := b.positions[positionID]
+	if !ok {
+		return nil, fmt.Errorf("%s: %w", positionID, trengin.ErrPositionNotFound)
+	}
+	return broker, nil
+}
+
+func (b *Broker) forget(positionID trengin.PositionID) {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+	delete(b.positions, positionID)
+}
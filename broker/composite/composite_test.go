@@ -0,0 +1,159 @@
+package composite
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/evsamsonov/trengin/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestBroker_OpenPosition(t *testing.T) {
+	sber := &trengin.MockBroker{}
+	gazp := &trengin.MockBroker{}
+	broker := New(map[string]trengin.Broker{"SBER": sber, "GAZP": gazp})
+	ctx := context.Background()
+
+	sberPosition := trengin.Position{ID: trengin.NewPositionID(), FIGI: "SBER"}
+	sberClosed := make(chan trengin.Position, 1)
+	sberAction := trengin.NewOpenPositionAction("SBER", trengin.Long, 1, 0, 0)
+	sber.On("OpenPosition", ctx, sberAction).Return(sberPosition, trengin.PositionClosed(sberClosed), nil)
+
+	gazpPosition := trengin.Position{ID: trengin.NewPositionID(), FIGI: "GAZP"}
+	gazpAction := trengin.NewOpenPositionAction("GAZP", trengin.Short, 2, 0, 0)
+	gazp.On("OpenPosition", ctx, gazpAction).
+		Return(gazpPosition, trengin.PositionClosed(make(chan trengin.Position)), nil)
+
+	position, closed, err := broker.OpenPosition(ctx, sberAction)
+	assert.NoError(t, err)
+	assert.Equal(t, sberPosition, position)
+
+	position, _, err = broker.OpenPosition(ctx, gazpAction)
+	assert.NoError(t, err)
+	assert.Equal(t, gazpPosition, position)
+
+	sber.AssertNumberOfCalls(t, "OpenPosition", 1)
+	gazp.AssertNumberOfCalls(t, "OpenPosition", 1)
+
+	sberClosed <- sberPosition
+	close(sberClosed)
+	assert.Equal(t, sberPosition, <-closed)
+	_, ok := <-closed
+	assert.False(t, ok)
+
+	_, err = broker.ClosePosition(ctx, trengin.NewClosePositionAction(sberPosition.ID))
+	assert.ErrorIs(t, err, trengin.ErrPositionNotFound)
+}
+
+func TestBroker_OpenPosition_unknownFIGI(t *testing.T) {
+	broker := New(map[string]trengin.Broker{"SBER": &trengin.MockBroker{}})
+	_, _, err := broker.OpenPosition(
+		context.Background(),
+		trengin.NewOpenPositionAction("GAZP", trengin.Long, 1, 0, 0),
+	)
+	assert.ErrorIs(t, err, ErrUnknownFIGI)
+}
+
+func TestBroker_ClosePosition(t *testing.T) {
+	sber := &trengin.MockBroker{}
+	gazp := &trengin.MockBroker{}
+	broker := New(map[string]trengin.Broker{"SBER": sber, "GAZP": gazp})
+	ctx := context.Background()
+
+	position := trengin.Position{ID: trengin.NewPositionID(), FIGI: "GAZP"}
+	gazp.On("OpenPosition", ctx, mock.Anything).
+		Return(position, trengin.PositionClosed(make(chan trengin.Position)), nil)
+	_, _, err := broker.OpenPosition(ctx, trengin.NewOpenPositionAction("GAZP", trengin.Long, 1, 0, 0))
+	assert.NoError(t, err)
+
+	changeAction := trengin.NewChangeConditionalOrderAction(position.ID, 90, 0)
+	changed := position
+	changed.StopLoss = 90
+	gazp.On("ChangeConditionalOrder", ctx, changeAction).Return(changed, nil)
+	result, err := broker.ChangeConditionalOrder(ctx, changeAction)
+	assert.NoError(t, err)
+	assert.Equal(t, changed, result)
+
+	closeAction := trengin.NewClosePositionAction(position.ID)
+	gazp.On("ClosePosition", ctx, closeAction).Return(position, nil)
+	result, err = broker.ClosePosition(ctx, closeAction)
+	assert.NoError(t, err)
+	assert.Equal(t, position, result)
+	sber.AssertNotCalled(t, "ClosePosition", mock.Anything, mock.Anything)
+
+	_, err = broker.ChangeConditionalOrder(ctx, changeAction)
+	assert.ErrorIs(t, err, trengin.ErrPositionNotFound)
+}
+
+func TestBroker_Run(t *testing.T) {
+	t.Run("runner error", func(t *testing.T) {
+		runErr := errors.New("run")
+		sber := &trengin.MockBrokerRunner{}
+		sber.On("Run", mock.Anything).Return(runErr)
+		gazp := &trengin.MockBrokerRunner{}
+		gazp.On("Run", mock.Anything).Return(func(ctx context.Context) error {
+			<-ctx.Done()
+			return nil
+		})
+		broker := New(map[string]trengin.Broker{"SBER": sber, "GAZP": gazp, "LKOH": &trengin.MockBroker{}})
+
+		err := broker.Run(context.Background())
+		assert.ErrorIs(t, err, runErr)
+		sber.AssertNumberOfCalls(t, "Run", 1)
+		gazp.AssertNumberOfCalls(t, "Run", 1)
+	})
+
+	t.Run("without runners", func(t *testing.T) {
+		broker := New(map[string]trengin.Broker{"SBER": &trengin.MockBroker{}})
+
+		ctx, cancel := context.WithCancel(context.Background())
+		done := make(chan error)
+		go func() {
+			done <- broker.Run(ctx)
+		}()
+
+		select {
+		case <-done:
+			assert.Fail(t, "Run returned before ctx is done")
+		case <-time.After(50 * time.Millisecond):
+		}
+		cancel()
+		assert.NoError(t, <-done)
+	})
+}
+
+func TestBroker_OpenPosition_stopped(t *testing.T) {
+	sber := &trengin.MockBroker{}
+	broker := New(map[string]trengin.Broker{"SBER": sber})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	assert.NoError(t, broker.Run(ctx))
+
+	position := trengin.Position{ID: trengin.NewPositionID(), FIGI: "SBER"}
+	sberClosed := make(chan trengin.Position, 2)
+	sber.On("OpenPosition", mock.Anything, mock.Anything).
+		Return(position, trengin.PositionClosed(sberClosed), nil)
+	action := trengin.NewOpenPositionAction("SBER", trengin.Long, 1, 0, 0)
+	_, closed, err := broker.OpenPosition(context.Background(), action)
+	assert.NoError(t, err)
+
+	// After Run is stopped, the delivery stops and the channel is closed
+	sberClosed <- position
+	sberClosed <- position
+	assert.Eventually(t, func() bool {
+		for {
+			select {
+			case _, ok := <-closed:
+				if !ok {
+					return true
+				}
+			default:
+				return false
+			}
+		}
+	}, time.Second, 10*time.Millisecond)
+}
@@ -0,0 +1,23 @@
+package trengin
+
+import (
+	"context"
+	"time"
+)
+
+// Candle is a price bar of an instrument
+type Candle struct {
+	Time   time.Time // Start time of the candle
+	Open   float64
+	High   float64
+	Low    float64
+	Close  float64
+	Volume int64 // Volume in lots
+}
+
+// CandleProvider can be implemented by Broker to provide historical candles,
+// for example, to warm up indicators at startup.
+type CandleProvider interface {
+	// Candles returns candles with the given interval from time from to time to
+	Candles(ctx context.Context, from, to time.Time, interval time.Duration) ([]Candle, error)
+}
@@ -0,0 +1,68 @@
+package trengin
+
+import "time"
+
+// Clock provides the current time and timers to Engine.
+// It allows to substitute the time in tests
+type Clock interface {
+	// Now returns the current time
+	Now() time.Time
+
+	// NewTimer creates a new Timer that sends the current time
+	// on its channel after at least duration d
+	NewTimer(d time.Duration) Timer
+}
+
+// Timer is a single event timer created by Clock
+type Timer interface {
+	// C returns the channel on which the time is delivered
+	C() <-chan time.Time
+
+	// Stop prevents the Timer from firing. It returns false
+	// if the timer has already expired or been stopped
+	Stop() bool
+}
+
+// WithClock returns Option which sets clock.
+// The default clock uses functions of the time package
+func WithClock(clock Clock) Option {
+	return func(e *Engine) {
+		e.clock = clock
+	}
+}
+
+type realClock struct{}
+
+func (realClock) Now() time.Time {
+	return time.Now()
+}
+
+func (realClock) NewTimer(d time.Duration) Timer {
+	return realTimer{timer: time.NewTimer(d)}
+}
+
+type realTimer struct {
+	timer *time.Timer
+}
+
+func (t realTimer) C() <-chan time.Time {
+	return t.timer.C
+}
+
+func (t realTimer) Stop() bool {
+	return t.timer.Stop()
+}
+
+func (e *Engine) now() time.Time {
+	if e.clock == nil {
+		return time.Now()
+	}
+	return e.clock.Now()
+}
+
+func (e *Engine) newTimer(d time.Duration) Timer {
+	if e.clock == nil {
+		return realClock{}.NewTimer(d)
+	}
+	return e.clock.NewTimer(d)
+}
@@ -0,0 +1,138 @@
+package trengin
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeClockTimer struct {
+	clock *fakeClock
+	at    time.Time
+	c     chan time.Time
+}
+
+func (t *fakeClockTimer) C() <-chan time.Time {
+	return t.c
+}
+
+func (t *fakeClockTimer) Stop() bool {
+	t.clock.mtx.Lock()
+	defer t.clock.mtx.Unlock()
+	for i, timer := range t.clock.timers {
+		if timer == t {
+			t.clock.timers = append(t.clock.timers[:i], t.clock.timers[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+type fakeClock struct {
+	mtx    sync.Mutex
+	now    time.Time
+	timers []*fakeClockTimer
+}
+
+func newFakeClock(now time.Time) *fakeClock {
+	return &fakeClock{now: now}
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) NewTimer(d time.Duration) Timer {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	timer := &fakeClockTimer{clock: c, at: c.now.Add(d), c: make(chan time.Time, 1)}
+	c.timers = append(c.timers, timer)
+	return timer
+}
+
+// pendingTimers returns the number of timers which are neither fired nor stopped
+func (c *fakeClock) pendingTimers() int {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	return len(c.timers)
+}
+
+// Add moves the clock forward by d and fires expired timers
+func (c *fakeClock) Add(d time.Duration) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	c.now = c.now.Add(d)
+	timers := c.timers[:0]
+	for _, timer := range c.timers {
+		if !timer.at.After(c.now) {
+			timer.c <- c.now
+			continue
+		}
+		timers = append(timers, timer)
+	}
+	c.timers = timers
+}
+
+func TestFakeClock_NewTimer(t *testing.T) {
+	clock := newFakeClock(time.Unix(100, 0))
+	timer := clock.NewTimer(time.Minute)
+
+	clock.Add(30 * time.Second)
+	select {
+	case <-timer.C():
+		assert.Fail(t, "timer fired too early")
+	default:
+	}
+
+	clock.Add(30 * time.Second)
+	select {
+	case now := <-timer.C():
+		assert.Equal(t, time.Unix(160, 0), now)
+	default:
+		assert.Fail(t, "timer not fired")
+	}
+	assert.False(t, timer.Stop())
+
+	timer = clock.NewTimer(time.Minute)
+	assert.True(t, timer.Stop())
+	clock.Add(time.Minute)
+	select {
+	case <-timer.C():
+		assert.Fail(t, "stopped timer fired")
+	default:
+	}
+}
+
+func TestRealClock_NewTimer(t *testing.T) {
+	timer := realClock{}.NewTimer(time.Hour)
+	assert.True(t, timer.Stop())
+	assert.False(t, timer.Stop())
+}
+
+func TestEngine_WithClock(t *testing.T) {
+	loc := time.FixedZone("MSK", 3*60*60)
+	clock := newFakeClock(time.Date(2023, 1, 10, 23, 0, 0, 0, loc))
+	engine := New(
+		&MockStrategy{},
+		&MockBroker{},
+		WithClock(clock),
+		WithDailyLossLimit(100),
+		WithDailyLossLimitLocation(loc),
+	)
+	assert.Equal(t, clock.Now(), engine.now())
+
+	engine.lossLimit.add(engine.now(), -150)
+	assert.True(t, engine.TradingHalted())
+
+	clock.Add(time.Hour)
+	assert.False(t, engine.TradingHalted())
+}
+
+func TestEngine_now(t *testing.T) {
+	engine := Engine{}
+	assert.WithinDuration(t, time.Now(), engine.now(), time.Second)
+}
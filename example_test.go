@@ -0,0 +1,36 @@
+package trengin_test
+
+import (
+	"context"
+	"log"
+
+	"github.com/evsamsonov/trengin/v2"
+)
+
+// BreakoutStrategy is an example of a strategy which embeds trengin.BaseStrategy
+type BreakoutStrategy struct {
+	trengin.BaseStrategy
+}
+
+func (s *BreakoutStrategy) Run(ctx context.Context, actions trengin.Actions) error {
+	s.Bind(actions)
+
+	result, err := s.OpenPosition(ctx, "BBG004730N88", trengin.Long, 1, 5, 15)
+	if err != nil {
+		return err
+	}
+	log.Printf("position opened: %s", result.Position.ID)
+
+	if err := result.Position.WaitClosed(ctx); err != nil {
+		return err
+	}
+	return nil
+}
+
+func ExampleBaseStrategy() {
+	var broker trengin.Broker // Use your broker implementation
+	engine := trengin.New(&BreakoutStrategy{}, broker)
+	if err := engine.Run(context.Background()); err != nil {
+		log.Fatal(err)
+	}
+}
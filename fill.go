@@ -0,0 +1,84 @@
+package trengin
+
+import (
+	"math"
+	"time"
+)
+
+// OrderSide is a side of an executed order
+type OrderSide int
+
+const (
+	Buy  OrderSide = 1
+	Sell OrderSide = -1
+)
+
+// Fill is an execution of an order by the position. It allows to track scaling
+// in and out of the position
+type Fill struct {
+	Time     time.Time
+	Side     OrderSide
+	Quantity int64 // Quantity in lots
+	Price    float64
+}
+
+// AddFill adds fill to the position. The opening fill is added by NewPosition
+// and the closing fill of the remaining quantity is added by Close.
+// Fills must mirror every change of the position quantity: Broker should call AddFill
+// whenever it scales the position in or out, including a partial closing which reduces Quantity.
+// Otherwise, Close adds the closing fill for the wrong quantity and RealizedProfit disagrees with Profit.
+// It is safe for concurrent use with other methods working with fills
+func (p *Position) AddFill(fill Fill) {
+	if p.fillsMtx != nil {
+		p.fillsMtx.Lock()
+		defer p.fillsMtx.Unlock()
+	}
+	p.fills = append(p.fills, fill)
+}
+
+// Fills returns fills of the position in the order of adding
+func (p *Position) Fills() []Fill {
+	return p.copyFills()
+}
+
+func (p *Position) copyFills() []Fill {
+	if p.fillsMtx != nil {
+		p.fillsMtx.RLock()
+		defer p.fillsMtx.RUnlock()
+	}
+	fills := make([]Fill, len(p.fills))
+	copy(fills, p.fills)
+	return fills
+}
+
+// RealizedProfit returns profit of the closed parts of the position by fills
+// calculated with average cost accounting. Commission is not taken into account
+func (p *Position) RealizedProfit() float64 {
+	var quantity, avgPrice, profit float64
+	for _, fill := range p.copyFills() {
+		fillQuantity := float64(fill.Quantity) * float64(fill.Side)
+		if quantity == 0 || math.Signbit(quantity) == math.Signbit(fillQuantity) {
+			avgPrice = (avgPrice*math.Abs(quantity) + fill.Price*math.Abs(fillQuantity)) /
+				(math.Abs(quantity) + math.Abs(fillQuantity))
+			quantity += fillQuantity
+			continue
+		}
+
+		closedQuantity := math.Min(math.Abs(quantity), math.Abs(fillQuantity))
+		profit += (fill.Price - avgPrice) * closedQuantity * math.Copysign(1, quantity)
+		if math.Abs(fillQuantity) > math.Abs(quantity) {
+			avgPrice = fill.Price
+		}
+		quantity += fillQuantity
+	}
+	return profit
+}
+
+// openQuantity returns the signed quantity of the position by fills
+func (p *Position) openQuantity() int64 {
+	var quantity int64
+	for _, fill := range p.copyFills() {
+		quantity += fill.Quantity * int64(fill.Side)
+	}
+	return quantity
+}
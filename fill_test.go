@@ -0,0 +1,70 @@
+package trengin
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPosition_RealizedProfit(t *testing.T) {
+	t.Run("scale in and partial scale out", func(t *testing.T) {
+		position, err := NewPosition(NewOpenPositionAction("FIGI", Long, 2, 0, 0), time.Unix(1, 0), 100)
+		assert.NoError(t, err)
+		assert.Equal(t, 0., position.RealizedProfit())
+
+		position.AddFill(Fill{Time: time.Unix(2, 0), Side: Buy, Quantity: 2, Price: 110})
+		assert.Equal(t, 0., position.RealizedProfit())
+
+		position.AddFill(Fill{Time: time.Unix(3, 0), Side: Sell, Quantity: 3, Price: 120})
+		assert.Equal(t, 45., position.RealizedProfit())
+
+		assert.NoError(t, position.Close(time.Unix(4, 0), 100))
+		assert.Equal(t, 40., position.RealizedProfit())
+		assert.Equal(t, []Fill{
+			{Time: time.Unix(1, 0), Side: Buy, Quantity: 2, Price: 100},
+			{Time: time.Unix(2, 0), Side: Buy, Quantity: 2, Price: 110},
+			{Time: time.Unix(3, 0), Side: Sell, Quantity: 3, Price: 120},
+			{Time: time.Unix(4, 0), Side: Sell, Quantity: 1, Price: 100},
+		}, position.Fills())
+	})
+
+	t.Run("short", func(t *testing.T) {
+		position, err := NewPosition(NewOpenPositionAction("FIGI", Short, 1, 0, 0), time.Unix(1, 0), 100)
+		assert.NoError(t, err)
+		position.AddFill(Fill{Time: time.Unix(2, 0), Side: Sell, Quantity: 1, Price: 90})
+		position.AddFill(Fill{Time: time.Unix(3, 0), Side: Buy, Quantity: 1, Price: 80})
+		assert.Equal(t, 15., position.RealizedProfit())
+
+		assert.NoError(t, position.Close(time.Unix(4, 0), 85))
+		assert.Equal(t, 25., position.RealizedProfit())
+		assert.Equal(t, Fill{Time: time.Unix(4, 0), Side: Buy, Quantity: 1, Price: 85}, position.Fills()[3])
+	})
+
+	t.Run("without fills", func(t *testing.T) {
+		position := Position{Type: Long, Quantity: 1, OpenPrice: 100, ClosePrice: 110}
+		assert.Equal(t, 0., position.RealizedProfit())
+		assert.Empty(t, position.Fills())
+	})
+}
+
+func TestPosition_AddFill_concurrent(t *testing.T) {
+	position, err := NewPosition(NewOpenPositionAction("FIGI", Long, 1, 0, 0), time.Unix(1, 0), 100)
+	assert.NoError(t, err)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			position.AddFill(Fill{Time: time.Unix(2, 0), Side: Buy, Quantity: 1, Price: 110})
+		}()
+		go func() {
+			defer wg.Done()
+			_ = position.RealizedProfit()
+		}()
+	}
+	wg.Wait()
+	assert.Len(t, position.Fills(), 11)
+}
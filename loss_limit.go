@@ -0,0 +1,71 @@
+package trengin
+
+import (
+	"sync"
+	"time"
+)
+
+// WithDailyLossLimit returns Option which sets the daily loss limit.
+// Realized profit of closed positions is accumulated during the day.
+// When the net loss exceeds amount, the engine rejects new positions
+// with ErrTradingHalted until the next day begins.
+// The default amount is 0, the limit is not set
+func WithDailyLossLimit(amount float64) Option {
+	return func(e *Engine) {
+		e.lossLimit.limit = amount
+	}
+}
+
+// WithDailyLossLimitLocation returns Option which sets location of the day
+// boundary. The daily loss limit is reset at midnight in this location.
+// The default location is time.Local
+func WithDailyLossLimitLocation(loc *time.Location) Option {
+	return func(e *Engine) {
+		e.lossLimit.location = loc
+	}
+}
+
+// TradingHalted returns true if the daily loss limit is exceeded
+// and opening new positions is rejected
+func (e *Engine) TradingHalted() bool {
+	return e.lossLimit.halted(e.now())
+}
+
+// dailyLossLimit accumulates realized profit within a day
+type dailyLossLimit struct {
+	mtx      sync.Mutex
+	limit    float64
+	location *time.Location
+	dayStart time.Time
+	profit   float64
+}
+
+func (d *dailyLossLimit) add(now time.Time, profit float64) {
+	d.mtx.Lock()
+	defer d.mtx.Unlock()
+	d.resetIfNewDay(now)
+	d.profit += profit
+}
+
+func (d *dailyLossLimit) halted(now time.Time) bool {
+	d.mtx.Lock()
+	defer d.mtx.Unlock()
+	if d.limit <= 0 {
+		return false
+	}
+	d.resetIfNewDay(now)
+	return -d.profit > d.limit
+}
+
+func (d *dailyLossLimit) resetIfNewDay(now time.Time) {
+	loc := d.location
+	if loc == nil {
+		loc = time.Local
+	}
+	year, month, day := now.In(loc).Date()
+	dayStart := time.Date(year, month, day, 0, 0, 0, 0, loc)
+	if !dayStart.Equal(d.dayStart) {
+		d.dayStart = dayStart
+		d.profit = 0
+	}
+}
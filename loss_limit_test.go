@@ -0,0 +1,83 @@
+package trengin
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"golang.org/x/sync/errgroup"
+)
+
+func TestDailyLossLimit(t *testing.T) {
+	loc := time.FixedZone("MSK", 3*60*60)
+	d := dailyLossLimit{limit: 100, location: loc}
+	now := time.Date(2023, 1, 10, 12, 0, 0, 0, loc)
+
+	d.add(now, -60)
+	assert.False(t, d.halted(now))
+
+	d.add(now, 30)
+	d.add(now, -60)
+	assert.False(t, d.halted(now))
+
+	d.add(now, -20)
+	assert.True(t, d.halted(now))
+	assert.True(t, d.halted(time.Date(2023, 1, 10, 23, 59, 59, 0, loc)))
+
+	assert.False(t, d.halted(time.Date(2023, 1, 11, 0, 0, 0, 0, loc)))
+}
+
+func TestDailyLossLimit_notSet(t *testing.T) {
+	d := dailyLossLimit{}
+	now := time.Now()
+	d.add(now, -1000)
+	assert.False(t, d.halted(now))
+}
+
+func TestEngine_doOpenPosition_dailyLossLimit(t *testing.T) {
+	broker := &MockBroker{}
+	engine := New(&MockStrategy{}, broker, WithDailyLossLimit(100))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	g := &errgroup.Group{}
+
+	openPosition := func(loss float64) {
+		resultChan := make(chan OpenPositionActionResult, 1)
+		action := OpenPositionAction{Type: Long, Quantity: 1, result: resultChan}
+		positionClosed := make(chan Position, 1)
+		broker.On("OpenPosition", mock.Anything, action).Return(Position{}, PositionClosed(positionClosed), nil).Once()
+
+		_, err := engine.doOpenPosition(ctx, g, action)
+		assert.NoError(t, err)
+		result := <-resultChan
+		assert.NoError(t, result.error)
+
+		positionClosed <- Position{Type: Long, Quantity: 1, OpenPrice: 100, ClosePrice: 100 - loss}
+		close(positionClosed)
+	}
+
+	openPosition(60)
+	assert.Eventually(t, func() bool {
+		engine.lossLimit.mtx.Lock()
+		defer engine.lossLimit.mtx.Unlock()
+		return engine.lossLimit.profit == -60
+	}, time.Second, 10*time.Millisecond)
+	assert.False(t, engine.TradingHalted())
+
+	openPosition(50)
+	assert.Eventually(t, engine.TradingHalted, time.Second, 10*time.Millisecond)
+
+	resultChan := make(chan OpenPositionActionResult, 1)
+	action := OpenPositionAction{Type: Long, Quantity: 1, result: resultChan}
+	_, err := engine.doOpenPosition(ctx, g, action)
+	assert.NoError(t, err)
+	result := <-resultChan
+	assert.ErrorIs(t, result.error, ErrTradingHalted)
+	broker.AssertNumberOfCalls(t, "OpenPosition", 2)
+
+	cancel()
+	_ = g.Wait()
+}
@@ -0,0 +1,35 @@
+package trengin
+
+// PositionResult describes the result of a closed position
+type PositionResult struct {
+	Position      Position
+	GrossProfit   float64 // Profit without commission
+	NetProfit     float64 // Profit taking into account commission, the same as Position.Profit
+	ReturnPercent float64 // NetProfit as percent of the position value at the opening price
+}
+
+// NewPositionResult calculates PositionResult of the closed position
+func NewPositionResult(position Position) PositionResult {
+	result := PositionResult{
+		Position:    position,
+		GrossProfit: position.ProfitByPrice(position.ClosePrice),
+		NetProfit:   position.Profit(),
+	}
+	if value := position.OpenPrice * float64(position.Quantity); value != 0 {
+		result.ReturnPercent = result.NetProfit / value * 100
+	}
+	return result
+}
+
+// OnPositionClosedResult sets callback f on closing a position. Unlike OnPositionClosed,
+// f receives PositionResult with the calculated profit. Both callbacks can be set,
+// f is called after the callback set by OnPositionClosed.
+// It returns Engine pointer, implementing the fluent interface.
+//
+// The method is not thread-safe. It should not be called in different goroutines
+// and after starting Engine. It panics if it is called while Engine is running
+func (e *Engine) OnPositionClosedResult(f func(result PositionResult)) *Engine {
+	e.mustNotBeStarted()
+	e.onPositionClosedResult = f
+	return e
+}
@@ -0,0 +1,44 @@
+package trengin
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewPositionResult(t *testing.T) {
+	position := Position{Type: Short, Quantity: 2, OpenPrice: 100, ClosePrice: 90, Commission: 4}
+	result := NewPositionResult(position)
+	assert.Equal(t, position, result.Position)
+	assert.Equal(t, 20., result.GrossProfit)
+	assert.Equal(t, 16., result.NetProfit)
+	assert.Equal(t, 8., result.ReturnPercent)
+
+	result = NewPositionResult(Position{Type: Long})
+	assert.Equal(t, 0., result.ReturnPercent)
+}
+
+func TestEngine_OnPositionClosedResult(t *testing.T) {
+	position := Position{ID: NewPositionID(), Type: Long, Quantity: 1, OpenPrice: 100, ClosePrice: 110, Commission: 1}
+
+	var calls []string
+	var result PositionResult
+	engine := New(&MockStrategy{}, &MockBroker{})
+	engine.OnPositionClosed(func(p Position) {
+		calls = append(calls, "position")
+	}).OnPositionClosedResult(func(r PositionResult) {
+		calls = append(calls, "result")
+		result = r
+	})
+
+	closed := make(chan Position, 1)
+	closed <- position
+	close(closed)
+	engine.trackPosition(context.Background(), position.ID, closed, nil)
+
+	assert.Equal(t, []string{"position", "result"}, calls)
+	assert.Equal(t, NewPositionResult(position), result)
+	assert.Equal(t, 10., result.GrossProfit)
+	assert.Equal(t, 9., result.NetProfit)
+}
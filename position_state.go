@@ -0,0 +1,78 @@
+package trengin
+
+import "sync/atomic"
+
+// PositionState is a lifecycle state of a position
+type PositionState int32
+
+const (
+	Opening         PositionState = iota // Position is not opened yet
+	Open                                 // Position is open
+	PartiallyClosed                      // Part of position quantity is closed
+	Closed                               // Position is closed
+)
+
+// String returns a text representation of the state
+func (s PositionState) String() string {
+	switch s {
+	case Opening:
+		return "opening"
+	case Open:
+		return "open"
+	case PartiallyClosed:
+		return "partially closed"
+	case Closed:
+		return "closed"
+	default:
+		return "unknown"
+	}
+}
+
+// State returns the current lifecycle state of the position. The position
+// created by NewPosition is Open. Broker which creates the position before
+// the entry order is filled, for example, for a stop entry, marks it Opening
+// by MarkOpening and then Open by MarkOpen. The position becomes PartiallyClosed
+// after calling MarkPartiallyClosed and Closed after calling Close.
+// The position which is not created by NewPosition and not marked is Open
+func (p *Position) State() PositionState {
+	if p.IsClosed() {
+		return Closed
+	}
+	if p.state == nil {
+		return Open
+	}
+	return PositionState(atomic.LoadInt32(p.state))
+}
+
+// MarkOpening sets the Opening state. It should be called by Broker
+// when the position is created before the entry order is filled
+func (p *Position) MarkOpening() {
+	p.setState(Opening)
+}
+
+// MarkOpen sets the Open state. It should be called by Broker
+// when the entry order of the Opening position is filled
+func (p *Position) MarkOpen() {
+	p.setState(Open)
+}
+
+// MarkPartiallyClosed sets the PartiallyClosed state. It should be called
+// by Broker when part of the position quantity is closed
+func (p *Position) MarkPartiallyClosed() {
+	p.setState(PartiallyClosed)
+}
+
+// setState stores state. The states of the copies of the position are changed too,
+// except the copies made before the first call for the position not created by NewPosition
+func (p *Position) setState(state PositionState) {
+	if p.state == nil {
+		p.state = newPositionState(state)
+		return
+	}
+	atomic.StoreInt32(p.state, int32(state))
+}
+
+func newPositionState(state PositionState) *int32 {
+	val := int32(state)
+	return &val
+}
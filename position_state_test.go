@@ -0,0 +1,53 @@
+package trengin
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPosition_State(t *testing.T) {
+	position := Position{}
+	assert.Equal(t, Open, position.State())
+	position.MarkPartiallyClosed()
+	assert.Equal(t, PartiallyClosed, position.State())
+
+	action := NewOpenPositionAction("FIGI", Long, 3, 0, 0)
+	opened, err := NewPosition(action, time.Unix(1, 0), 100)
+	assert.NoError(t, err)
+	assert.Equal(t, Open, opened.State())
+
+	copied := *opened
+	opened.MarkOpening()
+	assert.Equal(t, Opening, opened.State())
+	assert.Equal(t, Opening, copied.State())
+	opened.MarkOpen()
+	assert.Equal(t, Open, copied.State())
+
+	opened.MarkPartiallyClosed()
+	assert.Equal(t, PartiallyClosed, opened.State())
+	assert.Equal(t, PartiallyClosed, copied.State())
+
+	assert.NoError(t, opened.Close(time.Unix(2, 0), 110))
+	assert.Equal(t, Closed, opened.State())
+	assert.Equal(t, Closed, copied.State())
+}
+
+func TestPositionState_String(t *testing.T) {
+	tests := []struct {
+		state PositionState
+		want  string
+	}{
+		{state: Opening, want: "opening"},
+		{state: Open, want: "open"},
+		{state: PartiallyClosed, want: "partially closed"},
+		{state: Closed, want: "closed"},
+		{state: PositionState(10), want: "unknown"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.want, func(t *testing.T) {
+			assert.Equal(t, tt.want, tt.state.String())
+		})
+	}
+}
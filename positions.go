@@ -0,0 +1,175 @@
+package trengin
+
+import (
+	"context"
+	"fmt"
+	"sync"
+)
+
+// OpenPositions returns positions opened by the engine which are not closed yet
+func (e *Engine) OpenPositions() []Position {
+	return e.positions.list()
+}
+
+// ChangeAllConditionalOrders changes conditional orders of all open positions.
+// The function f calculates new stop loss and take profit values for each position.
+// If f returns 0 for stop loss or take profit, this value is not changed.
+// If f returns 0 for both, the position is skipped.
+// It returns the first error which occurred while changing conditional orders.
+//
+// The method should be called only while the engine is running
+// and should not be called from callbacks.
+func (e *Engine) ChangeAllConditionalOrders(
+	ctx context.Context,
+	f func(position Position) (stopLoss, takeProfit float64),
+) error {
+	var firstErr error
+	for _, position := range e.positions.list() {
+		stopLoss, takeProfit := f(position)
+		if stopLoss == 0 && takeProfit == 0 {
+			continue
+		}
+
+		action := NewChangeConditionalOrderAction(position.ID, stopLoss, takeProfit)
+		if err := e.sendAction(ctx, action); err != nil {
+			return err
+		}
+		if _, err := action.Result(ctx); err != nil {
+			if ctx.Err() != nil {
+				return err
+			}
+			if firstErr == nil {
+				firstErr = err
+			}
+		}
+	}
+	return firstErr
+}
+
+// MoveStopToBreakeven changes stop loss of the open position with positionID
+// to its break-even price taking into account commission (see Position.BreakEvenPrice).
+// It returns the changed position or ErrPositionNotFound if the position is not open.
+//
+// The method should be called only while the engine is running
+// and should not be called from callbacks.
+func (e *Engine) MoveStopToBreakeven(ctx context.Context, positionID PositionID) (Position, error) {
+	position, ok := e.positions.get(positionID)
+	if !ok {
+		return Position{}, ErrPositionNotFound
+	}
+
+	action := NewChangeConditionalOrderAction(positionID, position.BreakEvenPrice(), 0)
+	if err := e.sendAction(ctx, action); err != nil {
+		return Position{}, err
+	}
+	result, err := action.Result(ctx)
+	if err != nil {
+		return Position{}, err
+	}
+	return result.Position, nil
+}
+
+// ReversePosition closes the open position with positionID and opens a position
+// of the inverse type with the given quantity. If quantity is 0, the quantity
+// of the closed position is used. The new position is opened with stopLossOffset
+// and takeProfitOffset (see NewOpenPositionAction), so it is protected right after opening.
+// It returns ErrPositionNotFound if the position is not open. If the position
+// is closed but the new one is not opened, the returned error says so
+// and wraps the error of opening.
+//
+// The method should be called only while the engine is running
+// and should not be called from callbacks.
+func (e *Engine) ReversePosition(
+	ctx context.Context,
+	positionID PositionID,
+	quantity int64,
+	stopLossOffset float64,
+	takeProfitOffset float64,
+) (OpenPositionActionResult, error) {
+	position, ok := e.positions.get(positionID)
+	if !ok {
+		return OpenPositionActionResult{}, ErrPositionNotFound
+	}
+	if quantity == 0 {
+		quantity = position.Quantity
+	}
+
+	closeAction := NewClosePositionAction(positionID)
+	if err := e.sendAction(ctx, closeAction); err != nil {
+		return OpenPositionActionResult{}, err
+	}
+	if _, err := closeAction.Result(ctx); err != nil {
+		return OpenPositionActionResult{}, err
+	}
+
+	openAction := NewOpenPositionAction(
+		position.FIGI,
+		position.Type.Inverse(),
+		quantity,
+		stopLossOffset,
+		takeProfitOffset,
+	)
+	openAction.SecurityBoard = position.SecurityBoard
+	openAction.SecurityCode = position.SecurityCode
+	if err := e.sendAction(ctx, openAction); err != nil {
+		return OpenPositionActionResult{}, reverseOpenError(positionID, err)
+	}
+	result, err := openAction.Result(ctx)
+	if err != nil {
+		return OpenPositionActionResult{}, reverseOpenError(positionID, err)
+	}
+	return result, nil
+}
+
+// reverseOpenError wraps err of opening the reversed position
+// to make clear that the position with positionID is already closed
+func reverseOpenError(positionID PositionID, err error) error {
+	return fmt.Errorf("position %s is closed, but reversed position is not opened: %w", positionID, err)
+}
+
+// positionRegistry stores open positions
+type positionRegistry struct {
+	mtx       sync.RWMutex
+	positions map[PositionID]Position
+}
+
+func (r *positionRegistry) add(position Position) {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	if r.positions == nil {
+		r.positions = make(map[PositionID]Position)
+	}
+	r.positions[position.ID] = position
+}
+
+// update replaces the stored position if it exists
+func (r *positionRegistry) update(position Position) {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	if _, ok := r.positions[position.ID]; ok {
+		r.positions[position.ID] = position
+	}
+}
+
+func (r *positionRegistry) remove(id PositionID) {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	delete(r.positions, id)
+}
+
+func (r *positionRegistry) get(id PositionID) (Position, bool) {
+	r.mtx.RLock()
+	defer r.mtx.RUnlock()
+	position, ok := r.positions[id]
+	return position, ok
+}
+
+func (r *positionRegistry) list() []Position {
+	r.mtx.RLock()
+	defer r.mtx.RUnlock()
+	positions := make([]Position, 0, len(r.positions))
+	for _, position := range r.positions {
+		positions = append(positions, position)
+	}
+	return positions
+}
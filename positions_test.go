@@ -0,0 +1,337 @@
+package trengin
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"golang.org/x/sync/errgroup"
+)
+
+func TestPositionRegistry(t *testing.T) {
+	registry := positionRegistry{}
+	assert.Empty(t, registry.list())
+
+	position := Position{ID: NewPositionID(), StopLoss: 90}
+	registry.update(position)
+	assert.Empty(t, registry.list())
+
+	registry.add(position)
+	position.StopLoss = 95
+	registry.update(position)
+	got, ok := registry.get(position.ID)
+	assert.True(t, ok)
+	assert.Equal(t, 95., got.StopLoss)
+	assert.Len(t, registry.list(), 1)
+
+	registry.remove(position.ID)
+	_, ok = registry.get(position.ID)
+	assert.False(t, ok)
+}
+
+func TestEngine_ChangeAllConditionalOrders(t *testing.T) {
+	broker := &MockBroker{}
+	engine := New(&MockStrategy{}, broker)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	g := &errgroup.Group{}
+	actions := make(Actions)
+	control := engine.setRunning(ctx.Done())
+	g.Go(func() error {
+		return engine.run(ctx, g, actions, control)
+	})
+
+	positions := []Position{
+		{ID: NewPositionID(), Type: Long, OpenPrice: 100, StopLoss: 90},
+		{ID: NewPositionID(), Type: Short, OpenPrice: 200, StopLoss: 210},
+	}
+	for _, position := range positions {
+		action := NewOpenPositionAction("FIGI", position.Type, 1, 10, 0)
+		broker.On("OpenPosition", mock.Anything, action).
+			Return(position, PositionClosed(make(chan Position)), nil).Once()
+		assert.NoError(t, engine.sendAction(ctx, action))
+		_, err := action.Result(ctx)
+		assert.NoError(t, err)
+	}
+	assert.Len(t, engine.OpenPositions(), 2)
+
+	for _, position := range positions {
+		position := position
+		changed := position
+		changed.StopLoss = position.OpenPrice - 5*position.Type.Multiplier()
+		broker.On("ChangeConditionalOrder", mock.Anything, mock.MatchedBy(func(a ChangeConditionalOrderAction) bool {
+			return a.PositionID == position.ID
+		})).Return(changed, nil).Once()
+	}
+
+	err := engine.ChangeAllConditionalOrders(ctx, func(position Position) (float64, float64) {
+		return position.OpenPrice - 5*position.Type.Multiplier(), 0
+	})
+	assert.NoError(t, err)
+
+	broker.AssertNumberOfCalls(t, "ChangeConditionalOrder", 2)
+	for _, position := range positions {
+		broker.AssertCalled(t, "ChangeConditionalOrder", mock.Anything, mock.MatchedBy(
+			func(a ChangeConditionalOrderAction) bool {
+				return a.PositionID == position.ID &&
+					a.StopLoss == position.OpenPrice-5*position.Type.Multiplier() &&
+					a.TakeProfit == 0
+			},
+		))
+		got, ok := engine.positions.get(position.ID)
+		assert.True(t, ok)
+		assert.Equal(t, position.OpenPrice-5*position.Type.Multiplier(), got.StopLoss)
+	}
+
+	cancel()
+	_ = g.Wait()
+}
+
+func TestEngine_ChangeAllConditionalOrders_brokerError(t *testing.T) {
+	broker := &MockBroker{}
+	engine := New(&MockStrategy{}, broker)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	g := &errgroup.Group{}
+	actions := make(Actions)
+	control := engine.setRunning(ctx.Done())
+	g.Go(func() error {
+		return engine.run(ctx, g, actions, control)
+	})
+
+	failed := Position{ID: NewPositionID(), Type: Long, OpenPrice: 100}
+	changed := Position{ID: NewPositionID(), Type: Long, OpenPrice: 200}
+	engine.positions.add(failed)
+	engine.positions.add(changed)
+	brokerErr := errors.New("change error")
+	broker.On("ChangeConditionalOrder", mock.Anything, mock.MatchedBy(func(a ChangeConditionalOrderAction) bool {
+		return a.PositionID == failed.ID
+	})).Return(Position{}, brokerErr).Once()
+	broker.On("ChangeConditionalOrder", mock.Anything, mock.MatchedBy(func(a ChangeConditionalOrderAction) bool {
+		return a.PositionID == changed.ID
+	})).Return(changed, nil).Once()
+
+	err := engine.ChangeAllConditionalOrders(ctx, func(position Position) (float64, float64) {
+		return position.OpenPrice - 5, 0
+	})
+	assert.ErrorIs(t, err, brokerErr)
+	broker.AssertExpectations(t)
+
+	cancel()
+	_ = g.Wait()
+}
+
+func TestEngine_ChangeAllConditionalOrders_notRunning(t *testing.T) {
+	engine := New(&MockStrategy{}, &MockBroker{})
+	engine.positions.add(Position{ID: NewPositionID()})
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	err := engine.ChangeAllConditionalOrders(ctx, func(position Position) (float64, float64) {
+		return 1, 2
+	})
+	assert.ErrorIs(t, err, ErrNotRunning)
+}
+
+func TestEngine_ChangeAllConditionalOrders_actionsClosedByStrategy(t *testing.T) {
+	engine := runWithActionsClosedByStrategy(t)
+	engine.positions.add(Position{ID: NewPositionID()})
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	assert.NotPanics(t, func() {
+		err := engine.ChangeAllConditionalOrders(ctx, func(position Position) (float64, float64) {
+			return 1, 2
+		})
+		assert.ErrorIs(t, err, ErrNotRunning)
+	})
+}
+
+// runWithActionsClosedByStrategy returns engine which has been stopped
+// by the strategy closing the actions channel
+func runWithActionsClosedByStrategy(t *testing.T) *Engine {
+	strategy := StrategyFunc(func(ctx context.Context, actions Actions) error {
+		close(actions)
+		<-ctx.Done()
+		return nil
+	})
+	engine := New(strategy, &MockBroker{})
+	assert.NoError(t, engine.Run(context.Background()))
+	return engine
+}
+
+func TestEngine_MoveStopToBreakeven(t *testing.T) {
+	tests := []struct {
+		name     string
+		position Position
+		want     float64
+	}{
+		{
+			name:     "long",
+			position: Position{ID: NewPositionID(), Type: Long, Quantity: 1, OpenPrice: 100, StopLoss: 90},
+			want:     100,
+		},
+		{
+			name:     "short",
+			position: Position{ID: NewPositionID(), Type: Short, Quantity: 1, OpenPrice: 100, StopLoss: 110},
+			want:     100,
+		},
+		{
+			name: "long with commission",
+			position: Position{
+				ID: NewPositionID(), Type: Long, Quantity: 2, OpenPrice: 100, StopLoss: 90, Commission: 1,
+			},
+			want: 100.5,
+		},
+		{
+			name: "short with commission",
+			position: Position{
+				ID: NewPositionID(), Type: Short, Quantity: 2, OpenPrice: 100, StopLoss: 110, Commission: 1,
+			},
+			want: 99.5,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			broker := &MockBroker{}
+			engine := New(&MockStrategy{}, broker)
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			g := &errgroup.Group{}
+			actions := make(Actions)
+			control := engine.setRunning(ctx.Done())
+			g.Go(func() error {
+				return engine.run(ctx, g, actions, control)
+			})
+			engine.positions.add(tt.position)
+
+			changed := tt.position
+			changed.StopLoss = tt.want
+			broker.On("ChangeConditionalOrder", mock.Anything, mock.MatchedBy(func(a ChangeConditionalOrderAction) bool {
+				return a.PositionID == tt.position.ID && a.StopLoss == tt.want && a.TakeProfit == 0
+			})).Return(changed, nil).Once()
+
+			position, err := engine.MoveStopToBreakeven(ctx, tt.position.ID)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, position.StopLoss)
+
+			cancel()
+			_ = g.Wait()
+		})
+	}
+
+	t.Run("position not found", func(t *testing.T) {
+		engine := New(&MockStrategy{}, &MockBroker{})
+		_, err := engine.MoveStopToBreakeven(context.Background(), NewPositionID())
+		assert.ErrorIs(t, err, ErrPositionNotFound)
+	})
+
+	t.Run("actions closed by strategy", func(t *testing.T) {
+		engine := runWithActionsClosedByStrategy(t)
+		position := Position{ID: NewPositionID(), Type: Long, Quantity: 1, OpenPrice: 100}
+		engine.positions.add(position)
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		assert.NotPanics(t, func() {
+			_, err := engine.MoveStopToBreakeven(ctx, position.ID)
+			assert.ErrorIs(t, err, ErrNotRunning)
+		})
+	})
+}
+
+func TestEngine_ReversePosition(t *testing.T) {
+	broker := &MockBroker{}
+	engine := New(&MockStrategy{}, broker)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	g := &errgroup.Group{}
+	actions := make(Actions)
+	control := engine.setRunning(ctx.Done())
+	g.Go(func() error {
+		return engine.run(ctx, g, actions, control)
+	})
+
+	long := Position{
+		ID:         NewPositionID(),
+		FIGI:       "FIGI",
+		Type:       Long,
+		Quantity:   3,
+		OpenPrice:  100,
+		StopLoss:   100, // The stop is moved to break-even
+		TakeProfit: 130,
+	}
+	engine.positions.add(long)
+	short := Position{ID: NewPositionID(), FIGI: "FIGI", Type: Short, Quantity: 3}
+
+	broker.On("ClosePosition", mock.Anything, mock.MatchedBy(func(a ClosePositionAction) bool {
+		return a.PositionID == long.ID
+	})).Return(long, nil).Once()
+	broker.On("OpenPosition", mock.Anything, mock.MatchedBy(func(a OpenPositionAction) bool {
+		return a.FIGI == "FIGI" && a.Type == Short && a.Quantity == 3 &&
+			a.StopLossOffset == 5 && a.TakeProfitOffset == 10
+	})).Return(short, PositionClosed(make(chan Position)), nil).Once()
+
+	result, err := engine.ReversePosition(ctx, long.ID, 0, 5, 10)
+	assert.NoError(t, err)
+	assert.Equal(t, short, result.Position)
+
+	positions := engine.OpenPositions()
+	assert.Len(t, positions, 1)
+	assert.Equal(t, short.ID, positions[0].ID)
+
+	_, err = engine.ReversePosition(ctx, long.ID, 0, 5, 10)
+	assert.ErrorIs(t, err, ErrPositionNotFound)
+
+	cancel()
+	_ = g.Wait()
+}
+
+func TestEngine_ReversePosition_openFailed(t *testing.T) {
+	broker := &MockBroker{}
+	engine := New(&MockStrategy{}, broker)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	g := &errgroup.Group{}
+	actions := make(Actions)
+	control := engine.setRunning(ctx.Done())
+	g.Go(func() error {
+		return engine.run(ctx, g, actions, control)
+	})
+
+	long := Position{ID: NewPositionID(), FIGI: "FIGI", Type: Long, Quantity: 1}
+	engine.positions.add(long)
+	openErr := errors.New("open error")
+	broker.On("ClosePosition", mock.Anything, mock.Anything).Return(long, nil).Once()
+	broker.On("OpenPosition", mock.Anything, mock.Anything).
+		Return(Position{}, PositionClosed(nil), openErr).Once()
+
+	_, err := engine.ReversePosition(ctx, long.ID, 0, 5, 10)
+	assert.ErrorIs(t, err, openErr)
+	assert.EqualError(t, err, "position "+long.ID.String()+" is closed, but reversed position is not opened: open error")
+	assert.Empty(t, engine.OpenPositions())
+
+	cancel()
+	_ = g.Wait()
+}
+
+func TestEngine_ReversePosition_actionsClosedByStrategy(t *testing.T) {
+	engine := runWithActionsClosedByStrategy(t)
+	position := Position{ID: NewPositionID(), Type: Long, Quantity: 1}
+	engine.positions.add(position)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	assert.NotPanics(t, func() {
+		_, err := engine.ReversePosition(ctx, position.ID, 0, 5, 10)
+		assert.ErrorIs(t, err, ErrNotRunning)
+	})
+}
@@ -0,0 +1,154 @@
+package trengin
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+)
+
+const (
+	recordedOpenPosition           = "open_position"
+	recordedClosePosition          = "close_position"
+	recordedChangeConditionalOrder = "change_conditional_order"
+)
+
+// WithActionRecorder returns Option which sets w to record actions executed by the engine.
+// Every action is written as a JSON object on a separate line. It contains the type,
+// the public fields of the action, ID of the position the action relates to
+// and the error of execution if any. The actions rejected by the engine,
+// for example, with ErrActionNotValid or ErrTradingHalted, are recorded as well.
+// Recorded actions can be replayed with ReplayActions. Write errors are reported
+// to the callback set by WithOnError
+func WithActionRecorder(w io.Writer) Option {
+	return func(t *Engine) {
+		t.recorder = &actionRecorder{encoder: json.NewEncoder(w)}
+	}
+}
+
+type recordedAction struct {
+	Type       string          `json:"type"`
+	PositionID PositionID      `json:"position_id"`
+	Action     json.RawMessage `json:"action"`
+	Error      string          `json:"error,omitempty"`
+}
+
+// actionOutcome describes the result of action execution to record it
+type actionOutcome struct {
+	positionID PositionID
+	err        error
+}
+
+type actionRecorder struct {
+	mtx     sync.Mutex
+	encoder *json.Encoder
+}
+
+func (r *actionRecorder) record(actionType string, outcome actionOutcome, action interface{}) error {
+	data, err := json.Marshal(action)
+	if err != nil {
+		return err
+	}
+
+	recorded := recordedAction{
+		Type:       actionType,
+		PositionID: outcome.positionID,
+		Action:     data,
+	}
+	if outcome.err != nil {
+		recorded.Error = outcome.err.Error()
+	}
+
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	return r.encoder.Encode(recorded)
+}
+
+func (e *Engine) recordAction(actionType string, outcome actionOutcome, action interface{}) {
+	if e.recorder == nil {
+		return
+	}
+	if err := e.recorder.record(actionType, outcome, action); err != nil {
+		e.reportError(fmt.Errorf("record action: %w", err))
+	}
+}
+
+// ReplayActions returns Strategy which reads actions recorded by WithActionRecorder
+// from r and sends them to the engine one by one waiting for the results.
+// Position IDs of recorded close and change actions are replaced with IDs
+// of the positions opened during the replay. After all actions are sent,
+// it closes the actions channel that leads to finishing of the engine.
+func ReplayActions(r io.Reader) Strategy {
+	return &replayStrategy{reader: r}
+}
+
+type replayStrategy struct {
+	reader io.Reader
+}
+
+func (s *replayStrategy) Run(ctx context.Context, actions Actions) error {
+	decoder := json.NewDecoder(s.reader)
+	positionIDs := make(map[PositionID]PositionID)
+	replacePositionID := func(positionID PositionID) PositionID {
+		if id, ok := positionIDs[positionID]; ok {
+			return id
+		}
+		return positionID
+	}
+
+	for {
+		var recorded recordedAction
+		if err := decoder.Decode(&recorded); err != nil {
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			return fmt.Errorf("decode action: %w", err)
+		}
+
+		switch recorded.Type {
+		case recordedOpenPosition:
+			action := NewOpenPositionAction("", 0, 0, 0, 0)
+			if err := json.Unmarshal(recorded.Action, &action); err != nil {
+				return fmt.Errorf("decode open position action: %w", err)
+			}
+			if err := actions.send(ctx, action); err != nil {
+				return err
+			}
+			result, err := action.Result(ctx)
+			if err == nil && recorded.Error == "" && recorded.PositionID != (PositionID{}) {
+				positionIDs[recorded.PositionID] = result.Position.ID
+			}
+		case recordedClosePosition:
+			action := NewClosePositionAction(PositionID{})
+			if err := json.Unmarshal(recorded.Action, &action); err != nil {
+				return fmt.Errorf("decode close position action: %w", err)
+			}
+			action.PositionID = replacePositionID(action.PositionID)
+			if err := actions.send(ctx, action); err != nil {
+				return err
+			}
+			_, _ = action.Result(ctx)
+		case recordedChangeConditionalOrder:
+			action := NewChangeConditionalOrderAction(PositionID{}, 0, 0)
+			if err := json.Unmarshal(recorded.Action, &action); err != nil {
+				return fmt.Errorf("decode change conditional order action: %w", err)
+			}
+			action.PositionID = replacePositionID(action.PositionID)
+			if err := actions.send(ctx, action); err != nil {
+				return err
+			}
+			_, _ = action.Result(ctx)
+		default:
+			return fmt.Errorf("%s: %w", recorded.Type, ErrUnknownAction)
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+	}
+
+	close(actions)
+	<-ctx.Done()
+	return nil
+}
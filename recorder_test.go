@@ -0,0 +1,100 @@
+package trengin
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestActionRecorder_roundTrip(t *testing.T) {
+	mockBroker := func(position Position) *MockBroker {
+		broker := &MockBroker{}
+		broker.On("OpenPosition", mock.Anything, mock.MatchedBy(func(a OpenPositionAction) bool {
+			return a.FIGI == "FIGI" && a.Type == Short && a.Quantity == 2 &&
+				a.StopLossOffset == 5 && a.TakeProfitOffset == 10 && a.SecurityCode == "SBER"
+		})).Return(position, PositionClosed(make(chan Position)), nil)
+		broker.On("ChangeConditionalOrder", mock.Anything, mock.MatchedBy(func(a ChangeConditionalOrderAction) bool {
+			return a.PositionID == position.ID && a.StopLoss == 103 && a.TakeProfit == 0
+		})).Return(position, nil)
+		broker.On("ClosePosition", mock.Anything, mock.MatchedBy(func(a ClosePositionAction) bool {
+			return a.PositionID == position.ID
+		})).Return(position, nil)
+		return broker
+	}
+
+	recordedPosition := Position{ID: NewPositionID()}
+	recordedBroker := mockBroker(recordedPosition)
+	strategy := &MockStrategy{}
+	strategy.On("Run", mock.Anything, mock.Anything).Run(func(args mock.Arguments) {
+		ctx := args.Get(0).(context.Context)
+		actions := args.Get(1).(Actions)
+
+		action := NewOpenPositionAction("FIGI", Short, 2, 5, 10)
+		action.SecurityCode = "SBER"
+		assert.NoError(t, actions.send(ctx, action))
+		result, err := action.Result(ctx)
+		assert.NoError(t, err)
+
+		_, err = actions.ChangeConditionalOrder(ctx, result.Position.ID, 103, 0)
+		assert.NoError(t, err)
+		_, err = actions.ClosePosition(ctx, result.Position.ID)
+		assert.NoError(t, err)
+		close(actions)
+		<-ctx.Done()
+	}).Return(nil)
+
+	var buf bytes.Buffer
+	engine := New(strategy, recordedBroker, WithActionRecorder(&buf))
+	assert.NoError(t, engine.Run(context.Background()))
+	recordedBroker.AssertExpectations(t)
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	assert.Len(t, lines, 3)
+	assert.Contains(t, lines[0], `"type":"open_position"`)
+	assert.Contains(t, lines[0], `"position_id":"`+recordedPosition.ID.String()+`"`)
+	assert.NotContains(t, lines[0], "result")
+	assert.Contains(t, lines[1], `"type":"change_conditional_order"`)
+	assert.Contains(t, lines[2], `"type":"close_position"`)
+
+	replayedPosition := Position{ID: NewPositionID()}
+	replayedBroker := mockBroker(replayedPosition)
+	engine = New(ReplayActions(&buf), replayedBroker)
+	assert.NoError(t, engine.Run(context.Background()))
+	replayedBroker.AssertExpectations(t)
+}
+
+func TestActionRecorder_rejectedAction(t *testing.T) {
+	broker := &MockBroker{}
+	var buf bytes.Buffer
+	engine := New(nil, broker, WithActionRecorder(&buf))
+	actions := make(Actions)
+
+	done := make(chan error)
+	go func() {
+		done <- engine.RunWithActions(context.Background(), actions)
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	_, err := actions.OpenPosition(ctx, "FIGI", Long, 0, 0, 0)
+	assert.ErrorIs(t, err, ErrActionNotValid)
+	close(actions)
+	assert.NoError(t, <-done)
+	broker.AssertNotCalled(t, "OpenPosition", mock.Anything, mock.Anything)
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	assert.Len(t, lines, 1)
+	assert.Contains(t, lines[0], `"type":"open_position"`)
+	assert.Contains(t, lines[0], `"error":"action not valid"`)
+}
+
+func TestReplayActions_unknownAction(t *testing.T) {
+	engine := New(ReplayActions(strings.NewReader(`{"type":"unknown"}`)), &MockBroker{})
+	err := engine.Run(context.Background())
+	assert.ErrorIs(t, err, ErrUnknownAction)
+}
@@ -0,0 +1,79 @@
+package trengin
+
+import "time"
+
+// MarketSchedule describes trading hours of a market
+type MarketSchedule interface {
+	// IsTradingOpen returns true if trading is open at the time now
+	IsTradingOpen(now time.Time) bool
+}
+
+// WithMarketSchedule returns Option which sets the market schedule.
+// The engine rejects opening positions with ErrMarketClosed when trading is closed.
+// Closing positions and changing conditional orders are not restricted.
+// The default schedule is nil, trading is always open
+func WithMarketSchedule(schedule MarketSchedule) Option {
+	return func(e *Engine) {
+		e.marketSchedule = schedule
+	}
+}
+
+// Session is a daily trading session. Start and End are offsets from midnight,
+// End is not included in the session
+type Session struct {
+	Start time.Duration
+	End   time.Duration
+}
+
+// Calendar is MarketSchedule with daily sessions on trading days except holidays
+type Calendar struct {
+	Location    *time.Location // Location of sessions. If nil then time.Local is used
+	Sessions    []Session
+	TradingDays []time.Weekday // If empty then from Monday to Friday
+	Holidays    []time.Time    // Dates without trading in Location
+}
+
+// IsTradingOpen returns true if now is within one of the sessions on a trading day
+func (c *Calendar) IsTradingOpen(now time.Time) bool {
+	loc := c.Location
+	if loc == nil {
+		loc = time.Local
+	}
+	now = now.In(loc)
+	if !c.isTradingDay(now.Weekday()) {
+		return false
+	}
+
+	year, month, day := now.Date()
+	for _, holiday := range c.Holidays {
+		holidayYear, holidayMonth, holidayDay := holiday.In(loc).Date()
+		if holidayYear == year && holidayMonth == month && holidayDay == day {
+			return false
+		}
+	}
+
+	offset := now.Sub(time.Date(year, month, day, 0, 0, 0, 0, loc))
+	for _, session := range c.Sessions {
+		if offset >= session.Start && offset < session.End {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *Calendar) isTradingDay(weekday time.Weekday) bool {
+	if len(c.TradingDays) == 0 {
+		return weekday != time.Saturday && weekday != time.Sunday
+	}
+	for _, day := range c.TradingDays {
+		if day == weekday {
+			return true
+		}
+	}
+	return false
+}
+
+// isMarketClosed returns true if the market schedule is set and trading is closed
+func (e *Engine) isMarketClosed() bool {
+	return e.marketSchedule != nil && !e.marketSchedule.IsTradingOpen(e.now())
+}
@@ -0,0 +1,80 @@
+package trengin
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"golang.org/x/sync/errgroup"
+)
+
+func TestCalendar_IsTradingOpen(t *testing.T) {
+	loc := time.FixedZone("MSK", 3*60*60)
+	calendar := &Calendar{
+		Location: loc,
+		Sessions: []Session{
+			{Start: 10 * time.Hour, End: 14 * time.Hour},
+			{Start: 14*time.Hour + 5*time.Minute, End: 18*time.Hour + 45*time.Minute},
+		},
+		Holidays: []time.Time{time.Date(2023, 1, 2, 0, 0, 0, 0, loc)},
+	}
+
+	tests := []struct {
+		name string
+		now  time.Time
+		want bool
+	}{
+		{name: "session start", now: time.Date(2023, 1, 9, 10, 0, 0, 0, loc), want: true},
+		{name: "before session", now: time.Date(2023, 1, 9, 9, 59, 59, 0, loc), want: false},
+		{name: "clearing", now: time.Date(2023, 1, 9, 14, 0, 0, 0, loc), want: false},
+		{name: "second session", now: time.Date(2023, 1, 9, 14, 5, 0, 0, loc), want: true},
+		{name: "before session end", now: time.Date(2023, 1, 9, 18, 44, 59, 0, loc), want: true},
+		{name: "session end", now: time.Date(2023, 1, 9, 18, 45, 0, 0, loc), want: false},
+		{name: "other location", now: time.Date(2023, 1, 9, 7, 0, 0, 0, time.UTC), want: true},
+		{name: "saturday", now: time.Date(2023, 1, 7, 12, 0, 0, 0, loc), want: false},
+		{name: "holiday", now: time.Date(2023, 1, 2, 12, 0, 0, 0, loc), want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, calendar.IsTradingOpen(tt.now))
+		})
+	}
+}
+
+func TestCalendar_IsTradingOpen_tradingDays(t *testing.T) {
+	calendar := &Calendar{
+		Location:    time.UTC,
+		Sessions:    []Session{{Start: 0, End: 24 * time.Hour}},
+		TradingDays: []time.Weekday{time.Saturday},
+	}
+	assert.True(t, calendar.IsTradingOpen(time.Date(2023, 1, 7, 12, 0, 0, 0, time.UTC)))
+	assert.False(t, calendar.IsTradingOpen(time.Date(2023, 1, 9, 12, 0, 0, 0, time.UTC)))
+}
+
+func TestEngine_doOpenPosition_marketClosed(t *testing.T) {
+	broker := &MockBroker{}
+	clock := newFakeClock(time.Date(2023, 1, 9, 9, 0, 0, 0, time.UTC))
+	calendar := &Calendar{
+		Location: time.UTC,
+		Sessions: []Session{{Start: 10 * time.Hour, End: 18 * time.Hour}},
+	}
+	engine := New(&MockStrategy{}, broker, WithClock(clock), WithMarketSchedule(calendar))
+	ctx := context.Background()
+
+	action := NewOpenPositionAction("FIGI", Long, 1, 0, 0)
+	_, err := engine.doOpenPosition(ctx, &errgroup.Group{}, action)
+	assert.NoError(t, err)
+	_, err = action.Result(ctx)
+	assert.ErrorIs(t, err, ErrMarketClosed)
+	broker.AssertNotCalled(t, "OpenPosition", mock.Anything, mock.Anything)
+
+	clock.Add(time.Hour)
+	action = NewOpenPositionAction("FIGI", Long, 1, 0, 0)
+	broker.On("OpenPosition", mock.Anything, action).Return(Position{}, PositionClosed(make(chan Position)), nil)
+	_, err = engine.doOpenPosition(ctx, &errgroup.Group{}, action)
+	assert.NoError(t, err)
+	_, err = action.Result(ctx)
+	assert.NoError(t, err)
+}
@@ -0,0 +1,100 @@
+package trengin
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// WithClosePositionsOnShutdown returns Option which sets closePositionsOnShutdown.
+// If it is true, Close closes all open positions before stopping the engine.
+// The default closePositionsOnShutdown is false
+func WithClosePositionsOnShutdown(closePositionsOnShutdown bool) Option {
+	return func(t *Engine) {
+		t.closePositionsOnShutdown = closePositionsOnShutdown
+	}
+}
+
+// stopAction stops processing of actions after completion of the previous ones.
+// The result of the broker shutdown is sent to shutdown
+type stopAction struct {
+	ctx      context.Context
+	shutdown chan error
+}
+
+// Close gracefully stops the running engine. If the option WithClosePositionsOnShutdown
+// is set, it closes all open positions first. Then it waits for completion
+// of the current action, calls Shutdown of Broker which implements GracefulRunner,
+// stops the engine and waits until Run returns.
+// In this case Run returns nil instead of context.Canceled. The actions
+// which are still waiting to be executed get ErrNotRunning in their results.
+// It returns ErrNotRunning if the engine is not running or Run has already returned.
+// Otherwise, it returns the first error which occurred while closing positions
+// or shutting down the broker, or ctx.Err() if ctx is done earlier.
+//
+// The method should not be called from callbacks.
+func (e *Engine) Close(ctx context.Context) error {
+	e.runningMtx.RLock()
+	stopped := e.runningStopped
+	e.runningMtx.RUnlock()
+	if stopped == nil {
+		return ErrNotRunning
+	}
+	select {
+	case <-stopped:
+		return ErrNotRunning
+	default:
+	}
+
+	var closeErr error
+	if e.closePositionsOnShutdown {
+		for _, position := range e.positions.list() {
+			action := NewClosePositionAction(position.ID)
+			if err := e.sendAction(ctx, action); err != nil {
+				return err
+			}
+			if _, err := action.Result(ctx); err != nil && closeErr == nil {
+				closeErr = err
+			}
+		}
+	}
+
+	e.runningMtx.Lock()
+	e.closed = true
+	e.runningMtx.Unlock()
+
+	action := stopAction{ctx: ctx, shutdown: make(chan error, 1)}
+	if err := e.sendAction(ctx, action); err != nil && !errors.Is(err, ErrNotRunning) {
+		return err
+	}
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-stopped:
+	}
+	select {
+	case err := <-action.shutdown:
+		if closeErr == nil {
+			closeErr = err
+		}
+	default:
+	}
+	return closeErr
+}
+
+func (e *Engine) shutdownBroker(ctx context.Context) error {
+	runner, ok := e.broker.(GracefulRunner)
+	if !ok || e.preventBrokerRun {
+		return nil
+	}
+	if err := runner.Shutdown(ctx); err != nil {
+		return fmt.Errorf("shutdown broker: %w", err)
+	}
+	return nil
+}
+
+func (e *Engine) isClosed() bool {
+	e.runningMtx.RLock()
+	defer e.runningMtx.RUnlock()
+	return e.closed
+}
@@ -0,0 +1,161 @@
+package trengin
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"golang.org/x/sync/errgroup"
+)
+
+func TestEngine_Close(t *testing.T) {
+	strategy := &MockStrategy{}
+	broker := &MockBroker{}
+	engine := New(strategy, broker, WithClosePositionsOnShutdown(true))
+
+	positions := []Position{{ID: NewPositionID()}, {ID: NewPositionID()}}
+	for _, position := range positions {
+		position := position
+		broker.On("OpenPosition", mock.Anything, mock.MatchedBy(func(a OpenPositionAction) bool {
+			return a.FIGI == position.ID.String()
+		})).Return(position, PositionClosed(make(chan Position)), nil).Once()
+	}
+	var closedCount int64
+	broker.On("ClosePosition", mock.Anything, mock.Anything).Run(func(args mock.Arguments) {
+		atomic.AddInt64(&closedCount, 1)
+	}).Return(Position{}, nil)
+
+	strategy.On("Run", mock.Anything, mock.Anything).Run(func(args mock.Arguments) {
+		ctx := args.Get(0).(context.Context)
+		actions := args.Get(1).(Actions)
+		for _, position := range positions {
+			_, err := actions.OpenPosition(ctx, position.ID.String(), Long, 1, 0, 0)
+			assert.NoError(t, err)
+		}
+		<-ctx.Done()
+	}).Return(context.Canceled)
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		assert.NoError(t, engine.Run(context.Background()))
+	}()
+
+	assert.Eventually(t, func() bool {
+		return len(engine.OpenPositions()) == 2
+	}, time.Second, 10*time.Millisecond)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	assert.NoError(t, engine.Close(ctx))
+	assert.Equal(t, int64(2), atomic.LoadInt64(&closedCount))
+	assert.Empty(t, engine.OpenPositions())
+	wg.Wait()
+
+	assert.ErrorIs(t, engine.Close(ctx), ErrNotRunning)
+}
+
+func TestEngine_Close_notRunning(t *testing.T) {
+	engine := New(&MockStrategy{}, &MockBroker{})
+	assert.ErrorIs(t, engine.Close(context.Background()), ErrNotRunning)
+}
+
+func TestEngine_Close_actionsClosedByStrategy(t *testing.T) {
+	strategy := StrategyFunc(func(ctx context.Context, actions Actions) error {
+		close(actions)
+		<-ctx.Done()
+		return nil
+	})
+	engine := New(strategy, &MockBroker{})
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		assert.NoError(t, engine.Run(context.Background()))
+	}()
+	wg.Wait()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	assert.NotPanics(t, func() {
+		assert.ErrorIs(t, engine.Close(ctx), ErrNotRunning)
+	})
+}
+
+func TestEngine_run_stopAction(t *testing.T) {
+	var reportedErr error
+	engine := New(nil, &MockBroker{}, WithOnError(func(err error) {
+		reportedErr = err
+	}))
+	actions := make(Actions, 1)
+	control := make(Actions, 1)
+	closeAction := NewClosePositionAction(NewPositionID())
+	stop := stopAction{ctx: context.Background(), shutdown: make(chan error, 1)}
+	actions <- closeAction
+	control <- stop
+
+	assert.NoError(t, engine.run(context.Background(), &errgroup.Group{}, actions, control))
+	assert.NoError(t, <-stop.shutdown)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	_, err := closeAction.Result(ctx)
+	assert.ErrorIs(t, err, ErrNotRunning)
+	assert.EqualError(t, reportedErr, "1 actions drained on shutdown: engine not running")
+}
+
+type gracefulBroker struct {
+	*MockBroker
+	runCtx             chan context.Context
+	shutdownErr        error
+	canceledInShutdown bool
+}
+
+func (b *gracefulBroker) Run(ctx context.Context) error {
+	b.runCtx <- ctx
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+func (b *gracefulBroker) Shutdown(ctx context.Context) error {
+	runCtx := <-b.runCtx
+	b.canceledInShutdown = runCtx.Err() != nil
+	return b.shutdownErr
+}
+
+func TestEngine_Close_gracefulRunner(t *testing.T) {
+	shutdownErr := errors.New("shutdown")
+	broker := &gracefulBroker{
+		MockBroker:  &MockBroker{},
+		runCtx:      make(chan context.Context, 1),
+		shutdownErr: shutdownErr,
+	}
+	strategy := &MockStrategy{}
+	strategy.On("Run", mock.Anything, mock.Anything).Run(func(args mock.Arguments) {
+		<-args.Get(0).(context.Context).Done()
+	}).Return(context.Canceled)
+	engine := New(strategy, broker)
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		assert.NoError(t, engine.Run(context.Background()))
+	}()
+	assert.Eventually(t, func() bool {
+		return len(broker.runCtx) == 1
+	}, time.Second, 10*time.Millisecond)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	assert.ErrorIs(t, engine.Close(ctx), shutdownErr)
+	assert.False(t, broker.canceledInShutdown)
+	wg.Wait()
+}
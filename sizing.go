@@ -0,0 +1,29 @@
+package trengin
+
+import (
+	"fmt"
+	"math"
+)
+
+// QuantityForRisk returns the quantity of lots such that the loss on reaching the stop price
+// doesn't exceed riskPercent of equity. The entry and stop are prices per unit and lotSize
+// is the number of units in a lot. The result is rounded down to whole lots.
+// It returns 0 if the arguments don't allow to calculate the quantity
+func QuantityForRisk(equity, riskPercent, entry, stop float64, lotSize int64) int64 {
+	riskPerLot := math.Abs(entry-stop) * float64(lotSize)
+	if equity <= 0 || riskPercent <= 0 || riskPerLot == 0 || lotSize <= 0 {
+		return 0
+	}
+	budget := equity * riskPercent / 100
+	return int64(math.Floor(budget / riskPerLot))
+}
+
+// WholeQuantity converts quantity to whole lots. Quantity is int64 in lots,
+// so fractional lots are not supported. It returns ErrFractionalQuantity
+// if quantity has a fractional part
+func WholeQuantity(quantity float64) (int64, error) {
+	if quantity != math.Trunc(quantity) || math.IsInf(quantity, 0) {
+		return 0, fmt.Errorf("%w: %v", ErrFractionalQuantity, quantity)
+	}
+	return int64(quantity), nil
+}
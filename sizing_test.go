@@ -0,0 +1,100 @@
+package trengin
+
+import (
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestQuantityForRisk(t *testing.T) {
+	tests := []struct {
+		name        string
+		equity      float64
+		riskPercent float64
+		entry       float64
+		stop        float64
+		lotSize     int64
+		want        int64
+	}{
+		{
+			name:        "long",
+			equity:      100000,
+			riskPercent: 1,
+			entry:       250,
+			stop:        240,
+			lotSize:     10,
+			want:        10,
+		},
+		{
+			name:        "short",
+			equity:      100000,
+			riskPercent: 2,
+			entry:       250,
+			stop:        255,
+			lotSize:     1,
+			want:        400,
+		},
+		{
+			name:        "rounding down to whole lots",
+			equity:      100000,
+			riskPercent: 1,
+			entry:       250,
+			stop:        243,
+			lotSize:     10,
+			want:        14,
+		},
+		{
+			name:        "budget less than lot risk",
+			equity:      1000,
+			riskPercent: 1,
+			entry:       250,
+			stop:        240,
+			lotSize:     10,
+			want:        0,
+		},
+		{
+			name:        "zero stop distance",
+			equity:      100000,
+			riskPercent: 1,
+			entry:       250,
+			stop:        250,
+			lotSize:     10,
+			want:        0,
+		},
+		{
+			name:        "zero lot size",
+			equity:      100000,
+			riskPercent: 1,
+			entry:       250,
+			stop:        240,
+			lotSize:     0,
+			want:        0,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := QuantityForRisk(tt.equity, tt.riskPercent, tt.entry, tt.stop, tt.lotSize)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestWholeQuantity(t *testing.T) {
+	quantity, err := WholeQuantity(3)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(3), quantity)
+
+	quantity, err = WholeQuantity(-2)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(-2), quantity)
+
+	_, err = WholeQuantity(1.5)
+	assert.ErrorIs(t, err, ErrFractionalQuantity)
+
+	_, err = WholeQuantity(0.001)
+	assert.ErrorIs(t, err, ErrFractionalQuantity)
+
+	_, err = WholeQuantity(math.NaN())
+	assert.ErrorIs(t, err, ErrFractionalQuantity)
+}
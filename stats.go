@@ -0,0 +1,104 @@
+package trengin
+
+import "sync"
+
+// EngineStats describes aggregated results of positions closed
+// while the engine is running
+type EngineStats struct {
+	Positions int     // Number of closed positions
+	Wins      int     // Number of positions closed with profit
+	Losses    int     // Number of positions closed with loss
+	NetProfit float64 // Sum of profit of closed positions taking into account commission
+}
+
+// WinRate returns the share of positions closed with profit. It returns 0 if there are no positions
+func (s EngineStats) WinRate() float64 {
+	if s.Positions == 0 {
+		return 0
+	}
+	return float64(s.Wins) / float64(s.Positions)
+}
+
+func (s *EngineStats) add(profit float64) {
+	s.Positions++
+	s.NetProfit += profit
+	switch {
+	case profit > 0:
+		s.Wins++
+	case profit < 0:
+		s.Losses++
+	}
+}
+
+// WithInitialBalance returns Option which sets the initial balance. The engine tracks
+// equity by adding profit of each closed position to it. The default balance is 0
+func WithInitialBalance(balance float64) Option {
+	return func(e *Engine) {
+		e.stats.equity = balance
+		e.stats.peakEquity = balance
+	}
+}
+
+// Equity returns the initial balance plus profit of closed positions
+func (e *Engine) Equity() float64 {
+	e.stats.mtx.Lock()
+	defer e.stats.mtx.Unlock()
+	return e.stats.equity
+}
+
+// MaxDrawdown returns the maximum decline of equity from its peak in the currency
+func (e *Engine) MaxDrawdown() float64 {
+	e.stats.mtx.Lock()
+	defer e.stats.mtx.Unlock()
+	return e.stats.maxDrawdown
+}
+
+// Stats returns aggregated results of all closed positions
+func (e *Engine) Stats() EngineStats {
+	e.stats.mtx.Lock()
+	defer e.stats.mtx.Unlock()
+	return e.stats.total
+}
+
+// StatsByTag returns aggregated results of closed positions grouped by Position.Tag.
+// Positions without a tag are grouped under the empty string
+func (e *Engine) StatsByTag() map[string]EngineStats {
+	e.stats.mtx.Lock()
+	defer e.stats.mtx.Unlock()
+	result := make(map[string]EngineStats, len(e.stats.byTag))
+	for tag, stats := range e.stats.byTag {
+		result[tag] = stats
+	}
+	return result
+}
+
+// engineStats accumulates EngineStats and equity of closed positions
+type engineStats struct {
+	mtx         sync.Mutex
+	total       EngineStats
+	byTag       map[string]EngineStats
+	equity      float64
+	peakEquity  float64
+	maxDrawdown float64
+}
+
+func (s *engineStats) add(position Position) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	profit := position.Profit()
+	s.total.add(profit)
+	if s.byTag == nil {
+		s.byTag = make(map[string]EngineStats)
+	}
+	stats := s.byTag[position.Tag]
+	stats.add(profit)
+	s.byTag[position.Tag] = stats
+
+	s.equity += profit
+	if s.equity > s.peakEquity {
+		s.peakEquity = s.equity
+	}
+	if drawdown := s.peakEquity - s.equity; drawdown > s.maxDrawdown {
+		s.maxDrawdown = drawdown
+	}
+}
@@ -0,0 +1,55 @@
+package trengin
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEngineStats_WinRate(t *testing.T) {
+	assert.Equal(t, 0., EngineStats{}.WinRate())
+	assert.Equal(t, 0.25, EngineStats{Positions: 4, Wins: 1}.WinRate())
+}
+
+func TestEngine_StatsByTag(t *testing.T) {
+	engine := New(&MockStrategy{}, &MockBroker{})
+
+	closePosition := func(tag string, profit float64) {
+		position := Position{ID: NewPositionID(), Type: Long, Quantity: 1, OpenPrice: 100, ClosePrice: 100 + profit, Tag: tag}
+		closed := make(chan Position, 1)
+		closed <- position
+		close(closed)
+		engine.trackPosition(context.Background(), position.ID, closed, nil)
+	}
+	closePosition("breakout", 10)
+	closePosition("breakout", -4)
+	closePosition("breakout", 6)
+	closePosition("reversal", -3)
+	closePosition("", 0)
+
+	assert.Equal(t, EngineStats{Positions: 5, Wins: 2, Losses: 2, NetProfit: 9}, engine.Stats())
+	assert.Equal(t, map[string]EngineStats{
+		"breakout": {Positions: 3, Wins: 2, Losses: 1, NetProfit: 12},
+		"reversal": {Positions: 1, Losses: 1, NetProfit: -3},
+		"":         {Positions: 1},
+	}, engine.StatsByTag())
+	assert.InDelta(t, 2./3, engine.StatsByTag()["breakout"].WinRate(), 1e-9)
+}
+
+func TestEngine_Equity(t *testing.T) {
+	engine := New(&MockStrategy{}, &MockBroker{}, WithInitialBalance(1000))
+	assert.Equal(t, 1000., engine.Equity())
+	assert.Equal(t, 0., engine.MaxDrawdown())
+
+	for _, profit := range []float64{100, -50, -80, 200, -100} {
+		position := Position{ID: NewPositionID(), Type: Long, Quantity: 1, OpenPrice: 100, ClosePrice: 100 + profit}
+		closed := make(chan Position, 1)
+		closed <- position
+		close(closed)
+		engine.trackPosition(context.Background(), position.ID, closed, nil)
+	}
+
+	assert.Equal(t, 1070., engine.Equity())
+	assert.Equal(t, 130., engine.MaxDrawdown())
+}
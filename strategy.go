@@ -0,0 +1,64 @@
+package trengin
+
+import "context"
+
+// StrategyFunc is an adapter to allow the use of ordinary functions as Strategy
+type StrategyFunc func(ctx context.Context, actions Actions) error
+
+// Run calls f(ctx, actions)
+func (f StrategyFunc) Run(ctx context.Context, actions Actions) error {
+	return f(ctx, actions)
+}
+
+// BaseStrategy can be embedded into a Strategy implementation to send actions
+// through its helper methods. Bind should be called with actions passed to Run
+// before using the helpers, otherwise they return ErrNotRunning
+type BaseStrategy struct {
+	actions Actions
+}
+
+// Bind captures actions to send them by the helper methods
+func (s *BaseStrategy) Bind(actions Actions) {
+	s.actions = actions
+}
+
+// Actions returns the captured actions
+func (s *BaseStrategy) Actions() Actions {
+	return s.actions
+}
+
+// OpenPosition opens a position, see Actions.OpenPosition
+func (s *BaseStrategy) OpenPosition(
+	ctx context.Context,
+	figi string,
+	positionType PositionType,
+	quantity int64,
+	stopLossOffset float64,
+	takeProfitOffset float64,
+) (OpenPositionActionResult, error) {
+	if s.actions == nil {
+		return OpenPositionActionResult{}, ErrNotRunning
+	}
+	return s.actions.OpenPosition(ctx, figi, positionType, quantity, stopLossOffset, takeProfitOffset)
+}
+
+// ClosePosition closes the position, see Actions.ClosePosition
+func (s *BaseStrategy) ClosePosition(ctx context.Context, positionID PositionID) (ClosePositionActionResult, error) {
+	if s.actions == nil {
+		return ClosePositionActionResult{}, ErrNotRunning
+	}
+	return s.actions.ClosePosition(ctx, positionID)
+}
+
+// ChangeConditionalOrder changes conditional orders of the position, see Actions.ChangeConditionalOrder
+func (s *BaseStrategy) ChangeConditionalOrder(
+	ctx context.Context,
+	positionID PositionID,
+	stopLoss float64,
+	takeProfit float64,
+) (ChangeConditionalOrderActionResult, error) {
+	if s.actions == nil {
+		return ChangeConditionalOrderActionResult{}, ErrNotRunning
+	}
+	return s.actions.ChangeConditionalOrder(ctx, positionID, stopLoss, takeProfit)
+}
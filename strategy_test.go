@@ -0,0 +1,75 @@
+package trengin
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+type testBaseStrategy struct {
+	BaseStrategy
+	t *testing.T
+}
+
+func (s *testBaseStrategy) Run(ctx context.Context, actions Actions) error {
+	s.Bind(actions)
+
+	openResult, err := s.OpenPosition(ctx, "FIGI", Long, 1, 5, 10)
+	assert.NoError(s.t, err)
+
+	_, err = s.ChangeConditionalOrder(ctx, openResult.Position.ID, 101, 0)
+	assert.NoError(s.t, err)
+
+	_, err = s.ClosePosition(ctx, openResult.Position.ID)
+	assert.NoError(s.t, err)
+
+	close(s.Actions())
+	<-ctx.Done()
+	return nil
+}
+
+func TestBaseStrategy(t *testing.T) {
+	broker := &MockBroker{}
+	position := Position{ID: NewPositionID()}
+	broker.On("OpenPosition", mock.Anything, mock.MatchedBy(func(a OpenPositionAction) bool {
+		return a.FIGI == "FIGI" && a.Type == Long && a.Quantity == 1
+	})).Return(position, PositionClosed(make(chan Position)), nil).Once()
+	broker.On("ChangeConditionalOrder", mock.Anything, mock.MatchedBy(func(a ChangeConditionalOrderAction) bool {
+		return a.PositionID == position.ID && a.StopLoss == 101
+	})).Return(position, nil).Once()
+	broker.On("ClosePosition", mock.Anything, mock.MatchedBy(func(a ClosePositionAction) bool {
+		return a.PositionID == position.ID
+	})).Return(position, nil).Once()
+
+	engine := New(&testBaseStrategy{t: t}, broker)
+	assert.NoError(t, engine.Run(context.Background()))
+	broker.AssertExpectations(t)
+}
+
+func TestBaseStrategy_notBound(t *testing.T) {
+	s := BaseStrategy{}
+	ctx := context.Background()
+
+	_, err := s.OpenPosition(ctx, "FIGI", Long, 1, 0, 0)
+	assert.ErrorIs(t, err, ErrNotRunning)
+	_, err = s.ClosePosition(ctx, NewPositionID())
+	assert.ErrorIs(t, err, ErrNotRunning)
+	_, err = s.ChangeConditionalOrder(ctx, NewPositionID(), 1, 0)
+	assert.ErrorIs(t, err, ErrNotRunning)
+}
+
+func TestStrategyFunc(t *testing.T) {
+	var called bool
+	strategy := StrategyFunc(func(ctx context.Context, actions Actions) error {
+		called = true
+		close(actions)
+		<-ctx.Done()
+		return nil
+	})
+
+	engine := New(strategy, &MockBroker{})
+	assert.NoError(t, engine.Run(context.Background()))
+	assert.True(t, called)
+}
@@ -18,7 +18,10 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"math"
+	"strconv"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/google/uuid"
@@ -26,12 +29,54 @@ import (
 )
 
 var (
-	ErrSendResultTimeout = errors.New("send result timeout")
-	ErrUnknownAction     = errors.New("unknown action")
-	ErrAlreadyClosed     = errors.New("already closed")
-	ErrActionNotValid    = errors.New("action not valid")
+	ErrSendResultTimeout  = errors.New("send result timeout")
+	ErrUnknownAction      = errors.New("unknown action")
+	ErrAlreadyClosed      = errors.New("already closed")
+	ErrActionNotValid     = errors.New("action not valid")
+	ErrTradingHalted      = errors.New("trading halted")
+	ErrActionCanceled     = errors.New("action canceled")
+	ErrNotRunning         = errors.New("engine not running")
+	ErrPositionNotFound   = errors.New("position not found")
+	ErrFractionalQuantity = errors.New("fractional quantity")
+	ErrMarketClosed       = errors.New("market closed")
 )
 
+// SendResultTimeoutError is returned when the engine fails to send an action result
+// in time. It wraps ErrSendResultTimeout
+type SendResultTimeoutError struct {
+	Action     string     // Action description. Example, close position
+	PositionID PositionID // Identifier of the position the action relates to. Zero if unknown
+}
+
+func (e *SendResultTimeoutError) Error() string {
+	if e.PositionID == (PositionID{}) {
+		return fmt.Sprintf("%s: %s", e.Action, ErrSendResultTimeout)
+	}
+	return fmt.Sprintf("%s %s: %s", e.Action, e.PositionID, ErrSendResultTimeout)
+}
+
+func (e *SendResultTimeoutError) Unwrap() error {
+	return ErrSendResultTimeout
+}
+
+// canceledError is an error returned by Broker for the canceled action.
+// It matches both ErrActionCanceled and the broker error
+type canceledError struct {
+	err error
+}
+
+func (e *canceledError) Error() string {
+	return fmt.Sprintf("%s: %s", ErrActionCanceled, e.err)
+}
+
+func (e *canceledError) Is(target error) bool {
+	return target == ErrActionCanceled
+}
+
+func (e *canceledError) Unwrap() error {
+	return e.err
+}
+
 type (
 	PositionID   uuid.UUID
 	PositionType int
@@ -72,6 +117,18 @@ func (t PositionType) IsValid() bool {
 	return t == Long || t == Short
 }
 
+// String returns a text representation of the position type
+func (t PositionType) String() string {
+	switch t {
+	case Long:
+		return "long"
+	case Short:
+		return "short"
+	default:
+		return "unknown"
+	}
+}
+
 // Inverse returns inverted position type
 func (t PositionType) Inverse() PositionType {
 	if t.IsShort() {
@@ -80,8 +137,13 @@ func (t PositionType) Inverse() PositionType {
 	return Short
 }
 
-// NewPositionID creates unique position ID
-func NewPositionID() PositionID {
+// NewPositionID creates unique position ID. The optional generator
+// allows to create deterministic IDs, for example, in tests.
+// By default uuid.New is used
+func NewPositionID(generator ...func() uuid.UUID) PositionID {
+	if len(generator) > 0 && generator[0] != nil {
+		return PositionID(generator[0]())
+	}
 	return PositionID(uuid.New())
 }
 
@@ -89,6 +151,16 @@ func (p PositionID) String() string {
 	return uuid.UUID(p).String()
 }
 
+// MarshalText implements encoding.TextMarshaler
+func (p PositionID) MarshalText() ([]byte, error) {
+	return uuid.UUID(p).MarshalText()
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler
+func (p *PositionID) UnmarshalText(data []byte) error {
+	return (*uuid.UUID)(p).UnmarshalText(data)
+}
+
 //go:generate docker run --rm -v ${PWD}:/app -w /app/ vektra/mockery --name Strategy --inpackage --case snake
 
 // Strategy описывает интерфейс торговой стратегии. Позволяет реализовать стратегию,
@@ -102,7 +174,11 @@ type Strategy interface {
 
 // Actions это канал для передачи торговых действий от Strategy к Broker
 // Может принимать типы OpenPositionAction, ClosePositionAction, ChangeConditionalOrderAction.
-// Неожиданные типы приведут к ошибке и завершению работы Engine
+// Неожиданные типы приведут к ошибке и завершению работы Engine, если не отключен
+// строгий режим с помощью WithStrictActions.
+// Действия выполняются по одному в порядке отправки. Действие передается в Broker
+// только после завершения предыдущего, поэтому OpenPositionAction, отправленный сразу
+// после ClosePositionAction, выполнится, когда позиция уже закрыта
 type Actions chan interface{}
 
 //go:generate docker run --rm -v ${PWD}:/app -w /app/ vektra/mockery --name BrokerRunner --inpackage --case snake
@@ -116,7 +192,9 @@ type BrokerRunner interface {
 // Broker describes client for execution of trading operations.
 type Broker interface {
 	// OpenPosition opens a position and returns Position and PositionClosed channel,
-	// which will be sent closed position.
+	// which will be sent closed position. The ctx is canceled when the action
+	// is canceled by OpenPositionAction.Cancel, its timeout elapses or after the method returns,
+	// so it should not be used for tracking the open position.
 	OpenPosition(ctx context.Context, action OpenPositionAction) (Position, PositionClosed, error)
 
 	// ClosePosition closes a position and returns closed position.
@@ -132,9 +210,73 @@ type Runner interface {
 	Run(ctx context.Context) error
 }
 
+// GracefulRunner can be implemented by Broker client to finish in-flight work,
+// for example, processing of order trades, on Engine.Close. Shutdown is called after
+// completion of the actions sent earlier and before the context passed to Run is canceled
+type GracefulRunner interface {
+	Runner
+	Shutdown(ctx context.Context) error
+}
+
+// ErrorReporter can be implemented by Broker to report non-fatal errors
+// which don't stop its work, for example, a failed cancel of a stop order.
+// Engine passes to SetErrorHandler the callback set by WithOnError.
+type ErrorReporter interface {
+	SetErrorHandler(f func(err error))
+}
+
+// ProtectionMonitor can be implemented by Broker which tracks conditional orders
+// of open positions. When a conditional order disappears unexpectedly,
+// for example, it is rejected by the exchange, Broker should call the handler
+// with the unprotected position. Engine passes to SetProtectionLostHandler
+// the callback set by OnProtectionLost.
+type ProtectionMonitor interface {
+	SetProtectionLostHandler(f func(position Position))
+}
+
 // PositionClosed канал, в который отправляется позиция при закрытии
 type PositionClosed <-chan Position
 
+// MergeClosed merges several PositionClosed channels into one. The returned channel
+// is closed when all passed channels are closed or ctx is done. Nil channels are ignored.
+// The returned channel is buffered by the number of passed channels,
+// so one closed position from each of them can be delivered without
+// a waiting consumer. A consumer which stops reading earlier should cancel ctx
+// to release the goroutines forwarding closed positions
+func MergeClosed(ctx context.Context, closed ...PositionClosed) <-chan Position {
+	out := make(chan Position, len(closed))
+	var wg sync.WaitGroup
+	for _, c := range closed {
+		if c == nil {
+			continue
+		}
+		wg.Add(1)
+		go func(c PositionClosed) {
+			defer wg.Done()
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case position, ok := <-c:
+					if !ok {
+						return
+					}
+					select {
+					case <-ctx.Done():
+						return
+					case out <- position:
+					}
+				}
+			}
+		}(c)
+	}
+	go func() {
+		wg.Wait()
+		close(out)
+	}()
+	return out
+}
+
 // Position описывает торговую позицию. Идентификатор ID является уникальным
 // только в рамках одного запуска
 
@@ -153,11 +295,25 @@ type Position struct {
 	StopLoss      float64
 	TakeProfit    float64
 	Commission    float64
+	Tag           string // Strategy-level label of the position, for example, a signal name
+
+	// PriceStep is the minimum price increment and StepPrice is the cost of one price step
+	// in the currency, for example, for futures. If 0 then not set
+	PriceStep float64
+	StepPrice float64
+
+	// IntendedOpenPrice and IntendedClosePrice are the prices at which the broker
+	// intended to execute orders, for example, a limit price. If 0 then not set
+	IntendedOpenPrice  float64
+	IntendedClosePrice float64
 
 	extraMtx   *sync.RWMutex
 	extra      map[interface{}]interface{}
 	closedOnce *sync.Once
 	closed     chan struct{}
+	state      *int32
+	fillsMtx   *sync.RWMutex
+	fills      []Fill
 }
 
 // NewPosition создает новую позицию по action, с временем открытия openTime
@@ -184,10 +340,19 @@ func NewPosition(action OpenPositionAction, openTime time.Time, openPrice float6
 		OpenPrice:     openPrice,
 		StopLoss:      stopLoss,
 		TakeProfit:    takeProfit,
+		Tag:           action.Tag,
 		extraMtx:      &sync.RWMutex{},
 		extra:         make(map[interface{}]interface{}),
 		closed:        make(chan struct{}),
 		closedOnce:    &sync.Once{},
+		state:         newPositionState(Open),
+		fillsMtx:      &sync.RWMutex{},
+		fills: []Fill{{
+			Time:     openTime,
+			Side:     OrderSide(action.Type.Multiplier()),
+			Quantity: action.Quantity,
+			Price:    openPrice,
+		}},
 	}, nil
 }
 
@@ -199,6 +364,13 @@ func (p *Position) Close(closeTime time.Time, closePrice float64) (err error) {
 	p.closedOnce.Do(func() {
 		p.CloseTime = closeTime
 		p.ClosePrice = closePrice
+		if quantity := p.openQuantity(); quantity != 0 {
+			side := Sell
+			if quantity < 0 {
+				side, quantity = Buy, -quantity
+			}
+			p.AddFill(Fill{Time: closeTime, Side: side, Quantity: quantity, Price: closePrice})
+		}
 		close(p.closed)
 		err = nil
 	})
@@ -210,6 +382,17 @@ func (p *Position) Closed() <-chan struct{} {
 	return p.closed
 }
 
+// WaitClosed waits for the position closing. It returns nil when the position
+// is closed or ctx.Err() if ctx is done earlier
+func (p *Position) WaitClosed(ctx context.Context) error {
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-p.Closed():
+		return nil
+	}
+}
+
 // IsClosed returns true if position is closed
 func (p *Position) IsClosed() bool {
 	select {
@@ -241,13 +424,35 @@ func (p *Position) Profit() float64 {
 	return p.UnitProfit() * float64(p.Quantity)
 }
 
-// UnitProfit returns profit per volume unit
+// ProfitRounded returns Profit rounded to the minor unit of the currency (2 decimal places).
+// It removes floating-point noise, for example, 153.89999999999998 becomes 153.9
+func (p *Position) ProfitRounded() float64 {
+	return math.Round(p.Profit()*100) / 100
+}
+
+// ProfitInCurrency returns profit of closed position in the currency taking into account
+// PriceStep and StepPrice. If they are not set, it returns the same value as Profit
+func (p *Position) ProfitInCurrency() float64 {
+	if p.PriceStep == 0 || p.StepPrice == 0 {
+		return p.Profit()
+	}
+	steps := (p.ClosePrice - p.OpenPrice) * p.Type.Multiplier() / p.PriceStep
+	return steps*p.StepPrice*float64(p.Quantity) - p.Commission
+}
+
+// UnitProfit returns profit per volume unit. It returns 0 if quantity is 0
 func (p *Position) UnitProfit() float64 {
+	if p.Quantity == 0 {
+		return 0
+	}
 	return (p.ClosePrice-p.OpenPrice)*p.Type.Multiplier() - p.UnitCommission()
 }
 
-// UnitCommission returns commission per volume unit
+// UnitCommission returns commission per volume unit. It returns 0 if quantity is 0
 func (p *Position) UnitCommission() float64 {
+	if p.Quantity == 0 {
+		return 0
+	}
 	return p.Commission / float64(p.Quantity)
 }
 
@@ -256,11 +461,112 @@ func (p *Position) ProfitByPrice(price float64) float64 {
 	return (price - p.OpenPrice) * p.Type.Multiplier() * float64(p.Quantity)
 }
 
+// BreakEvenPrice returns the price at which profit of the position taking into account
+// its commission is zero. The open price is shifted by the commission per unit
+// in the direction of profit
+func (p *Position) BreakEvenPrice() float64 {
+	return p.OpenPrice + p.UnitCommission()*p.Type.Multiplier()
+}
+
+// StopLossDistance returns signed distance per unit from the open price to the stop loss
+// in the direction of profit. It is negative if the stop loss limits a loss.
+// It returns 0 if the stop loss is not set
+func (p *Position) StopLossDistance() float64 {
+	if p.StopLoss == 0 {
+		return 0
+	}
+	return (p.StopLoss - p.OpenPrice) * p.Type.Multiplier()
+}
+
+// TakeProfitDistance returns signed distance per unit from the open price to the take profit
+// in the direction of profit. It returns 0 if the take profit is not set
+func (p *Position) TakeProfitDistance() float64 {
+	if p.TakeProfit == 0 {
+		return 0
+	}
+	return (p.TakeProfit - p.OpenPrice) * p.Type.Multiplier()
+}
+
+// RiskAmount returns StopLossDistance multiplied by quantity
+func (p *Position) RiskAmount() float64 {
+	return p.StopLossDistance() * float64(p.Quantity)
+}
+
+// RewardAmount returns TakeProfitDistance multiplied by quantity
+func (p *Position) RewardAmount() float64 {
+	return p.TakeProfitDistance() * float64(p.Quantity)
+}
+
+// Slippage returns money gained (positive) or lost (negative) because of
+// the difference between intended and actual prices of opening and closing.
+// The intended price which is not set is not taken into account
+func (p *Position) Slippage() float64 {
+	var slippage float64
+	if p.IntendedOpenPrice != 0 {
+		slippage += (p.IntendedOpenPrice - p.OpenPrice) * p.Type.Multiplier()
+	}
+	if p.IntendedClosePrice != 0 {
+		slippage += (p.ClosePrice - p.IntendedClosePrice) * p.Type.Multiplier()
+	}
+	return slippage * float64(p.Quantity)
+}
+
 // Duration возвращает длительность закрытой сделки
 func (p *Position) Duration() time.Duration {
 	return p.CloseTime.Sub(p.OpenTime)
 }
 
+// String returns a one-line summary of the position: the first 8 characters of ID,
+// type, quantity, prices, profit of the closed position and state
+//
+// Unlike other methods, it has a value receiver, because positions are passed
+// to callbacks and results by value and should be formatted by fmt as well
+func (p Position) String() string {
+	id := p.ID.String()
+	buf := make([]byte, 0, 96)
+	buf = append(buf, id[:8]...)
+	buf = append(buf, ' ')
+	buf = append(buf, p.Type.String()...)
+	buf = append(buf, " qty="...)
+	buf = strconv.AppendInt(buf, p.Quantity, 10)
+	buf = append(buf, " open="...)
+	buf = strconv.AppendFloat(buf, p.OpenPrice, 'f', -1, 64)
+	state := p.State()
+	if state == Closed {
+		buf = append(buf, " close="...)
+		buf = strconv.AppendFloat(buf, p.ClosePrice, 'f', -1, 64)
+		buf = append(buf, " profit="...)
+		buf = strconv.AppendFloat(buf, p.ProfitRounded(), 'f', -1, 64)
+	}
+	buf = append(buf, " state="...)
+	buf = append(buf, state.String()...)
+	return string(buf)
+}
+
+// EqualValue returns true if the exported fields of the positions are equal.
+// Times are compared by time.Time.Equal. Extra data, state, fills and closing
+// channel are not compared
+func (p *Position) EqualValue(other Position) bool {
+	return p.ID == other.ID &&
+		p.SecurityBoard == other.SecurityBoard &&
+		p.SecurityCode == other.SecurityCode &&
+		p.FIGI == other.FIGI &&
+		p.Type == other.Type &&
+		p.Quantity == other.Quantity &&
+		p.OpenTime.Equal(other.OpenTime) &&
+		p.OpenPrice == other.OpenPrice &&
+		p.CloseTime.Equal(other.CloseTime) &&
+		p.ClosePrice == other.ClosePrice &&
+		p.StopLoss == other.StopLoss &&
+		p.TakeProfit == other.TakeProfit &&
+		p.Commission == other.Commission &&
+		p.Tag == other.Tag &&
+		p.PriceStep == other.PriceStep &&
+		p.StepPrice == other.StepPrice &&
+		p.IntendedOpenPrice == other.IntendedOpenPrice &&
+		p.IntendedClosePrice == other.IntendedClosePrice
+}
+
 // Extra получает значение дополнительного поля по ключу key.
 // Если значение не задано, то вернет nil
 func (p *Position) Extra(key interface{}) interface{} {
@@ -297,15 +603,32 @@ type OpenPositionAction struct {
 	FIGI             string // Financial Instrument Global Identifier
 	Type             PositionType
 	Quantity         int64
-	StopLossOffset   float64 // Stop loss offset from the opening price. If 0 then stop loss is not set
-	TakeProfitOffset float64 //  Take profit offset from the opening price. If 0 then stop loss is not set
-
-	result chan OpenPositionActionResult
+	StopLossOffset   float64       // Stop loss offset from the opening price. If 0 then stop loss is not set
+	TakeProfitOffset float64       //  Take profit offset from the opening price. If 0 then stop loss is not set
+	TriggerPrice     float64       // Price to open the position by a stop order. If 0 then it is opened at once
+	Timeout          time.Duration // Timeout of execution by Broker. If 0 then the engine default is used
+	ValidUntil       time.Time     // Expiration time of conditional orders. If zero then they are valid until canceled
+	Tag              string        // Strategy-level label which is copied to Position, for example, a signal name
+	DisplayQuantity  int64         // Visible quantity of an iceberg entry order. If 0 then the whole quantity is visible
+
+	result     chan OpenPositionActionResult
+	cancelOnce *sync.Once
+	canceled   chan struct{}
 }
 
 // IsValid проверяет, что действие валидно
 func (a *OpenPositionAction) IsValid() bool {
-	return a.Type.IsValid() && a.Quantity > 0
+	return a.Type.IsValid() &&
+		a.Quantity > 0 &&
+		a.TriggerPrice >= 0 &&
+		a.DisplayQuantity >= 0 &&
+		a.DisplayQuantity <= a.Quantity
+}
+
+// IsStopEntry returns true if the position should be opened by a stop order
+// when the price reaches TriggerPrice
+func (a *OpenPositionAction) IsStopEntry() bool {
+	return a.TriggerPrice > 0
 }
 
 // OpenPositionActionResult результат открытия позиции
@@ -331,12 +654,89 @@ func NewOpenPositionAction(
 		Quantity:         quantity,
 		StopLossOffset:   stopLossOffset,
 		TakeProfitOffset: takeProfitOffset,
-		result:           make(chan OpenPositionActionResult),
+		result:           make(chan OpenPositionActionResult, 1),
+		cancelOnce:       &sync.Once{},
+		canceled:         make(chan struct{}),
+	}
+}
+
+// NewOpenPositionActionWithTimeout creates OpenPositionAction which Broker should execute
+// within timeout, for example, a limit entry which can take longer than a market one.
+// Otherwise, Result returns context.DeadlineExceeded. See NewOpenPositionAction
+// for the description of other arguments
+func NewOpenPositionActionWithTimeout(
+	figi string,
+	positionType PositionType,
+	quantity int64,
+	stopLossOffset float64,
+	takeProfitOffset float64,
+	timeout time.Duration,
+) OpenPositionAction {
+	action := NewOpenPositionAction(figi, positionType, quantity, stopLossOffset, takeProfitOffset)
+	action.Timeout = timeout
+	return action
+}
+
+// NewLongPositionAction creates OpenPositionAction to open a long position.
+// See NewOpenPositionAction for the description of arguments
+func NewLongPositionAction(figi string, quantity int64, stopLossOffset, takeProfitOffset float64) OpenPositionAction {
+	return NewOpenPositionAction(figi, Long, quantity, stopLossOffset, takeProfitOffset)
+}
+
+// NewShortPositionAction creates OpenPositionAction to open a short position.
+// See NewOpenPositionAction for the description of arguments
+func NewShortPositionAction(figi string, quantity int64, stopLossOffset, takeProfitOffset float64) OpenPositionAction {
+	return NewOpenPositionAction(figi, Short, quantity, stopLossOffset, takeProfitOffset)
+}
+
+// Cancel cancels the action. If the engine has not passed the action
+// to the broker yet, the position will not be opened and Result
+// will return ErrActionCanceled. If the broker is opening the position,
+// the context passed to Broker.OpenPosition is canceled. Repeated calls do nothing.
+func (a *OpenPositionAction) Cancel() {
+	if a.cancelOnce == nil {
+		return
 	}
+	a.cancelOnce.Do(func() {
+		close(a.canceled)
+	})
+}
+
+// IsCanceled returns true if the action is canceled
+func (a *OpenPositionAction) IsCanceled() bool {
+	select {
+	case <-a.canceled:
+		return true
+	default:
+	}
+	return false
+}
+
+// withCancel returns a copy of ctx which is also canceled when the action is canceled
+func (a *OpenPositionAction) withCancel(ctx context.Context) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(ctx)
+	if a.canceled == nil {
+		return ctx, cancel
+	}
+	go func() {
+		select {
+		case <-a.canceled:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	return ctx, cancel
 }
 
 // Result возвращает результат выполнения действия на открытие позиции.
 func (a *OpenPositionAction) Result(ctx context.Context) (OpenPositionActionResult, error) {
+	// The ready result takes precedence over ctx which can be done
+	// at the same time, for example, when the engine is stopped by an action error
+	select {
+	case result := <-a.result:
+		return result, result.error
+	default:
+	}
 	select {
 	case <-ctx.Done():
 		return OpenPositionActionResult{}, ctx.Err()
@@ -348,6 +748,8 @@ func (a *OpenPositionAction) Result(ctx context.Context) (OpenPositionActionResu
 // ClosePositionAction описывает действие по закрытию позиции.
 type ClosePositionAction struct {
 	PositionID PositionID
+	LimitPrice float64       // Price of limit order to close the position. If 0 then market order is used
+	Timeout    time.Duration // Timeout of execution by Broker. If 0 then the engine default is used
 	result     chan ClosePositionActionResult
 }
 
@@ -355,10 +757,27 @@ type ClosePositionAction struct {
 func NewClosePositionAction(positionID PositionID) ClosePositionAction {
 	return ClosePositionAction{
 		PositionID: positionID,
-		result:     make(chan ClosePositionActionResult),
+		result:     make(chan ClosePositionActionResult, 1),
 	}
 }
 
+// NewClosePositionActionWithTimeout creates an action to close the position with the given positionID
+// which Broker should execute within timeout. Otherwise, Result returns context.DeadlineExceeded
+func NewClosePositionActionWithTimeout(positionID PositionID, timeout time.Duration) ClosePositionAction {
+	action := NewClosePositionAction(positionID)
+	action.Timeout = timeout
+	return action
+}
+
+// NewLimitClosePositionAction creates an action to close the position with the given positionID
+// by limit order with limitPrice. Broker decides how to act if the order is not filled in time,
+// for example, it can fall back to market order.
+func NewLimitClosePositionAction(positionID PositionID, limitPrice float64) ClosePositionAction {
+	action := NewClosePositionAction(positionID)
+	action.LimitPrice = limitPrice
+	return action
+}
+
 // ClosePositionActionResult описывает результат закрытия позиции.
 type ClosePositionActionResult struct {
 	Position Position
@@ -367,6 +786,11 @@ type ClosePositionActionResult struct {
 
 // Result возвращает результат выполнения действия на закрытия позиции.
 func (a *ClosePositionAction) Result(ctx context.Context) (ClosePositionActionResult, error) {
+	select {
+	case result := <-a.result:
+		return result, result.error
+	default:
+	}
 	select {
 	case <-ctx.Done():
 		return ClosePositionActionResult{}, ctx.Err()
@@ -378,15 +802,31 @@ func (a *ClosePositionAction) Result(ctx context.Context) (ClosePositionActionRe
 // ChangeConditionalOrderAction описывает действие на изменение условной заявки
 // позиции с идентификатором PositionID. При передаче StopLoss или TakeProfit
 // равным 0 данные значения не должны изменяться.
+// To cancel the stop loss or take profit without setting a new one, set ClearStopLoss
+// or ClearTakeProfit. In this case the corresponding value should be 0.
 type ChangeConditionalOrderAction struct {
-	PositionID PositionID
-	StopLoss   float64
-	TakeProfit float64
-	result     chan ChangeConditionalOrderActionResult
+	PositionID      PositionID
+	StopLoss        float64
+	TakeProfit      float64
+	ClearStopLoss   bool          // Cancel the stop loss of the position
+	ClearTakeProfit bool          // Cancel the take profit of the position
+	Timeout         time.Duration // Timeout of execution by Broker. If 0 then the engine default is used
+	ValidUntil      time.Time     // Expiration time of conditional orders. If zero then they are valid until canceled
+	result          chan ChangeConditionalOrderActionResult
+}
+
+// IsValid returns false if the stop loss or take profit is set and cleared at once
+func (a *ChangeConditionalOrderAction) IsValid() bool {
+	return !(a.ClearStopLoss && a.StopLoss != 0) && !(a.ClearTakeProfit && a.TakeProfit != 0)
 }
 
 // Result возвращает канал, который вернет результат выполнения действия на изменения условной заявки.
 func (a *ChangeConditionalOrderAction) Result(ctx context.Context) (ChangeConditionalOrderActionResult, error) {
+	select {
+	case result := <-a.result:
+		return result, result.error
+	default:
+	}
 	select {
 	case <-ctx.Done():
 		return ChangeConditionalOrderActionResult{}, ctx.Err()
@@ -409,7 +849,7 @@ func NewChangeConditionalOrderAction(positionID PositionID, stopLoss, takeProfit
 		PositionID: positionID,
 		StopLoss:   stopLoss,
 		TakeProfit: takeProfit,
-		result:     make(chan ChangeConditionalOrderActionResult),
+		result:     make(chan ChangeConditionalOrderActionResult, 1),
 	}
 }
 
@@ -423,15 +863,112 @@ func WithPreventBrokerRun(preventBrokerRun bool) Option {
 	}
 }
 
+// WithOnError returns Option which sets a callback on non-fatal errors.
+// These errors don't stop Engine, unlike errors returned from Run.
+// The callback is also passed to Broker which implements ErrorReporter.
+// It can be called from different goroutines
+func WithOnError(f func(err error)) Option {
+	return func(t *Engine) {
+		t.onError = f
+	}
+}
+
+// WithContinueOnActionError returns Option which sets continueOnActionError.
+// By default, Engine stops if it fails to execute an action, for example,
+// when the result can't be sent in time (see ErrSendResultTimeout).
+// If continueOnActionError is true, such an error doesn't stop Engine,
+// it is reported to the callback set by WithOnError instead.
+// Errors returned by Broker are sent to the action result and don't stop Engine
+// in any case. The default continueOnActionError is false
+func WithContinueOnActionError(continueOnActionError bool) Option {
+	return func(t *Engine) {
+		t.continueOnActionError = continueOnActionError
+	}
+}
+
+// WithStrictActions returns Option which sets strict handling of actions.
+// If it is false, an unknown value sent to the actions channel doesn't stop Engine.
+// The value is skipped and ErrUnknownAction is reported to the callback set by WithOnError.
+// The default strict is true
+func WithStrictActions(strict bool) Option {
+	return func(t *Engine) {
+		t.skipUnknownActions = !strict
+	}
+}
+
+// WithPositionClosedBuffer returns Option which sets the buffer size of PositionClosed channels
+// passed to Strategy and to the engine. A larger buffer allows Broker to send several positions
+// to PositionClosed, for example, on partial closing, without waiting for consumers.
+// The default size is 1
+func WithPositionClosedBuffer(size int) Option {
+	return func(t *Engine) {
+		t.positionClosedBuffer = size
+	}
+}
+
+// WithPositionOpenedBeforeResult returns Option which sets positionOpenedBeforeResult.
+// By default the callback set by OnPositionOpened is called after sending the result
+// of OpenPositionAction, so the strategy can receive the result before the callback completes.
+// If it is true, the callback is called before sending the result.
+// The default positionOpenedBeforeResult is false
+func WithPositionOpenedBeforeResult(positionOpenedBeforeResult bool) Option {
+	return func(t *Engine) {
+		t.positionOpenedBeforeResult = positionOpenedBeforeResult
+	}
+}
+
+// WithActionTimeout returns Option which sets the default timeout of action execution by Broker.
+// The context passed to Broker is canceled when the timeout elapses. The timeout of the action
+// takes precedence over the default. The default is 0, not limited
+func WithActionTimeout(d time.Duration) Option {
+	return func(t *Engine) {
+		t.actionTimeout = d
+	}
+}
+
+// WithMaxHoldDuration returns Option which sets the maximum holding time of a position.
+// When the time elapses, the engine closes the position. An error of closing, for example,
+// ErrAlreadyClosed when the position is closed by a stop order at the same time,
+// doesn't stop Engine and is reported to the callback set by WithOnError.
+// The default is 0, not limited
+func WithMaxHoldDuration(d time.Duration) Option {
+	return func(t *Engine) {
+		t.maxHoldDuration = d
+	}
+}
+
 // Engine описывыет торговый движок. Создавать следует через конструктор New
 type Engine struct {
-	strategy                  Strategy
-	broker                    Broker
-	onPositionOpened          func(position Position)
-	onPositionClosed          func(position Position)
-	onConditionalOrderChanged func(position Position)
-	sendResultTimeout         time.Duration
-	preventBrokerRun          bool
+	strategy                   Strategy
+	broker                     Broker
+	onPositionOpened           func(position Position)
+	onPositionClosed           func(position Position)
+	onPositionClosedResult     func(result PositionResult)
+	onProtectionLost           func(position Position)
+	onConditionalOrderChanged  func(position Position)
+	onError                    func(err error)
+	sendResultTimeout          time.Duration
+	preventBrokerRun           bool
+	continueOnActionError      bool
+	skipUnknownActions         bool
+	positionOpenedBeforeResult bool
+	closePositionsOnShutdown   bool
+	lossLimit                  dailyLossLimit
+	marketSchedule             MarketSchedule
+	stats                      engineStats
+	clock                      Clock
+	positions                  positionRegistry
+	maxHoldDuration            time.Duration
+	actionTimeout              time.Duration
+	positionClosedBuffer       int
+	recorder                   *actionRecorder
+
+	started        atomic.Bool
+	runningMtx     sync.RWMutex
+	runningControl Actions
+	runningDone    <-chan struct{}
+	runningStopped chan struct{}
+	closed         bool
 }
 
 // New создает экземпляр Engine и возвращает указатель на него
@@ -440,6 +977,7 @@ func New(strategy Strategy, broker Broker, opts ...Option) *Engine {
 		strategy:          strategy,
 		broker:            broker,
 		sendResultTimeout: 1 * time.Second,
+		clock:             realClock{},
 	}
 	for _, opt := range opts {
 		opt(engine)
@@ -449,9 +987,32 @@ func New(strategy Strategy, broker Broker, opts ...Option) *Engine {
 
 // Run запускает стратегию в работу
 func (e *Engine) Run(ctx context.Context) error {
+	return e.RunWithActions(ctx, make(Actions))
+}
+
+// RunWithActions runs the engine with the actions channel provided by the caller.
+// It allows to send actions to the engine without implementing Strategy.
+// If Strategy is set, it is run with the same channel. The engine stops
+// when ctx is done, Close is called or the channel is closed
+func (e *Engine) RunWithActions(ctx context.Context, actions Actions) error {
+	e.started.Store(true)
+	defer e.started.Store(false)
 	ctx, cancel := context.WithCancel(ctx)
 	g, ctx := errgroup.WithContext(ctx)
-	actions := make(Actions)
+	control := e.setRunning(ctx.Done())
+	stopped := make(chan struct{})
+	defer close(stopped)
+	e.runningMtx.Lock()
+	e.runningStopped = stopped
+	e.closed = false
+	e.runningMtx.Unlock()
+
+	if reporter, ok := e.broker.(ErrorReporter); ok && e.onError != nil {
+		reporter.SetErrorHandler(e.onError)
+	}
+	if monitor, ok := e.broker.(ProtectionMonitor); ok && e.onProtectionLost != nil {
+		monitor.SetProtectionLostHandler(e.onProtectionLost)
+	}
 
 	runner, ok := e.broker.(Runner)
 	if ok && !e.preventBrokerRun {
@@ -461,44 +1022,173 @@ func (e *Engine) Run(ctx context.Context) error {
 		})
 	}
 
-	g.Go(func() error {
-		defer cancel()
-		return e.strategy.Run(ctx, actions)
-	})
+	if e.strategy != nil {
+		g.Go(func() error {
+			defer cancel()
+			return e.strategy.Run(ctx, actions)
+		})
+	}
 
 	g.Go(func() error {
 		defer cancel()
-		return e.run(ctx, g, actions)
+		return e.run(ctx, g, actions, control)
 	})
 
-	return g.Wait()
+	err := g.Wait()
+	if errors.Is(err, context.Canceled) && e.isClosed() {
+		return nil
+	}
+	return err
+}
+
+// setRunning stores done of the running engine and creates the control channel
+// which is used to send actions initiated by the engine itself. Unlike
+// the strategy channel, the control channel is never closed
+func (e *Engine) setRunning(done <-chan struct{}) Actions {
+	e.runningMtx.Lock()
+	defer e.runningMtx.Unlock()
+	e.runningDone = done
+	e.runningControl = make(Actions)
+	return e.runningControl
+}
+
+// sendAction sends action to the running engine through the control channel
+func (e *Engine) sendAction(ctx context.Context, action interface{}) error {
+	e.runningMtx.RLock()
+	done, control := e.runningDone, e.runningControl
+	e.runningMtx.RUnlock()
+	if control == nil {
+		return ErrNotRunning
+	}
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-done:
+		return ErrNotRunning
+	case control <- action:
+	}
+	return nil
 }
 
-func (e *Engine) run(ctx context.Context, g *errgroup.Group, actions Actions) error {
+// run executes actions received from the strategy channel actions
+// and the control channel of the engine
+func (e *Engine) run(ctx context.Context, g *errgroup.Group, actions, control Actions) error {
 	for {
-		select {
-		case <-ctx.Done():
+		if ctx.Err() != nil {
+			e.drainActions(ctx.Err(), actions, control)
 			return ctx.Err()
+		}
+		action, ok := e.receiveAction(ctx, actions, control)
+		if !ok {
+			if err := ctx.Err(); err != nil {
+				e.drainActions(err, actions, control)
+				return err
+			}
+			e.drainActions(ErrNotRunning, control)
+			return nil
+		}
+
+		var outcome actionOutcome
+		var err error
+		switch action := action.(type) {
+		case stopAction:
+			action.shutdown <- e.shutdownBroker(action.ctx)
+			e.drainActions(ErrNotRunning, actions, control)
+			return nil
+		case OpenPositionAction:
+			outcome, err = e.doOpenPosition(ctx, g, action)
+			e.recordAction(recordedOpenPosition, outcome, action)
+		case ClosePositionAction:
+			outcome, err = e.doClosePosition(ctx, action)
+			e.recordAction(recordedClosePosition, outcome, action)
+		case ChangeConditionalOrderAction:
+			outcome, err = e.doChangeConditionalOrder(ctx, action)
+			e.recordAction(recordedChangeConditionalOrder, outcome, action)
+		default:
+			err = fmt.Errorf("%v: %w", action, ErrUnknownAction)
+			if e.skipUnknownActions {
+				e.reportError(err)
+				continue
+			}
+			return err
+		}
+		if err != nil {
+			if !e.continueOnActionError {
+				return err
+			}
+			e.reportError(err)
+		}
+	}
+}
+
+// receiveAction receives the next action. The actions of the control channel
+// take precedence over the actions of the strategy. It returns false
+// if ctx is done or the strategy channel is closed
+func (e *Engine) receiveAction(ctx context.Context, actions, control Actions) (interface{}, bool) {
+	select {
+	case action := <-control:
+		return action, true
+	default:
+	}
+	select {
+	case <-ctx.Done():
+		return nil, false
+	case action := <-control:
+		return action, true
+	case action, ok := <-actions:
+		return action, ok
+	}
+}
+
+// drainActions receives the actions which are ready to be read after the engine is stopped
+// and sends err to their results, so Result returns without waiting for its context.
+// The number of drained actions is reported to the callback set by WithOnError
+func (e *Engine) drainActions(err error, channels ...Actions) {
+	var count int
+	for _, actions := range channels {
+		count += e.drainChannel(err, actions)
+	}
+	if count > 0 {
+		e.reportError(fmt.Errorf("%d actions drained on shutdown: %w", count, err))
+	}
+}
+
+func (e *Engine) drainChannel(err error, actions Actions) int {
+	var count int
+	for {
+		select {
 		case action, ok := <-actions:
 			if !ok {
-				return nil
+				return count
 			}
-			switch action := action.(type) {
-			case OpenPositionAction:
-				if err := e.doOpenPosition(ctx, g, action); err != nil {
-					return err
-				}
-			case ClosePositionAction:
-				if err := e.doClosePosition(ctx, action); err != nil {
-					return err
-				}
-			case ChangeConditionalOrderAction:
-				if err := e.doChangeConditionalOrder(ctx, action); err != nil {
-					return err
-				}
-			default:
-				return fmt.Errorf("%v: %w", action, ErrUnknownAction)
+			if _, ok := action.(stopAction); ok {
+				continue
 			}
+			count++
+			e.cancelAction(err, action)
+		default:
+			return count
+		}
+	}
+}
+
+func (e *Engine) cancelAction(err error, action interface{}) {
+	switch action := action.(type) {
+	case OpenPositionAction:
+		select {
+		case action.result <- OpenPositionActionResult{error: err}:
+		default:
+		}
+	case ClosePositionAction:
+		select {
+		case action.result <- ClosePositionActionResult{error: err}:
+		default:
+		}
+	case ChangeConditionalOrderAction:
+		select {
+		case action.result <- ChangeConditionalOrderActionResult{error: err}:
+		default:
 		}
 	}
 }
@@ -508,8 +1198,9 @@ func (e *Engine) run(ctx context.Context, g *errgroup.Group, actions Actions) er
 // Возвращает указатель на Engine, реализуя текучий интерфейс.
 //
 // Метод не потокобезопасен. Не следует вызывать в разных горутинах
-// и после запуска Engine
+// и после запуска Engine. При вызове во время работы Engine вызывает панику
 func (e *Engine) OnPositionOpened(f func(position Position)) *Engine {
+	e.mustNotBeStarted()
 	e.onPositionOpened = f
 	return e
 }
@@ -519,8 +1210,9 @@ func (e *Engine) OnPositionOpened(f func(position Position)) *Engine {
 // Возвращает указатель на Engine, реализуя текучий интерфейс.
 //
 // Метод не потокобезопасен. Не следует вызывать в разных горутинах
-// и после запуска Engine
+// и после запуска Engine. При вызове во время работы Engine вызывает панику
 func (e *Engine) OnConditionalOrderChanged(f func(position Position)) *Engine {
+	e.mustNotBeStarted()
 	e.onConditionalOrderChanged = f
 	return e
 }
@@ -530,20 +1222,82 @@ func (e *Engine) OnConditionalOrderChanged(f func(position Position)) *Engine {
 // Возвращает указатель на Engine, реализуя текучий интерфейс.
 //
 // Метод не потокобезопасен. Не следует вызывать в разных горутинах
-// и после запуска Engine
+// и после запуска Engine. При вызове во время работы Engine вызывает панику
 func (e *Engine) OnPositionClosed(f func(position Position)) *Engine {
+	e.mustNotBeStarted()
 	e.onPositionClosed = f
 	return e
 }
 
-func (e *Engine) doOpenPosition(ctx context.Context, g *errgroup.Group, action OpenPositionAction) error {
-	position, closed, err := e.broker.OpenPosition(ctx, action)
+// OnProtectionLost sets callback f on losing a conditional order of the open position,
+// for example, when a stop order is rejected by the exchange. The callback is passed
+// to Broker which implements ProtectionMonitor, it can be called from different goroutines.
+// It returns Engine pointer, implementing the fluent interface.
+//
+// The method is not thread-safe. It should not be called in different goroutines
+// and after starting Engine. It panics if it is called while Engine is running
+func (e *Engine) OnProtectionLost(f func(position Position)) *Engine {
+	e.mustNotBeStarted()
+	e.onProtectionLost = f
+	return e
+}
+
+// mustNotBeStarted panics if Engine is running. It protects callbacks
+// which are read without synchronization from changing during the work
+func (e *Engine) mustNotBeStarted() {
+	if e.started.Load() {
+		panic("trengin: callback is set while Engine is running")
+	}
+}
+
+func (e *Engine) doOpenPosition(
+	ctx context.Context,
+	g *errgroup.Group,
+	action OpenPositionAction,
+) (actionOutcome, error) {
+	if !action.IsValid() {
+		return e.rejectOpenPosition(ctx, action, ErrActionNotValid)
+	}
+	if action.IsCanceled() {
+		return e.rejectOpenPosition(ctx, action, ErrActionCanceled)
+	}
+	if e.TradingHalted() {
+		return e.rejectOpenPosition(ctx, action, ErrTradingHalted)
+	}
+	if e.isMarketClosed() {
+		return e.rejectOpenPosition(ctx, action, ErrMarketClosed)
+	}
+	if err := e.checkValidUntil(action.ValidUntil); err != nil {
+		return e.rejectOpenPosition(ctx, action, err)
+	}
+
+	brokerCtx, cancelTimeout := e.actionContext(ctx, action.Timeout)
+	brokerCtx, cancel := action.withCancel(brokerCtx)
+	position, closed, err := e.broker.OpenPosition(brokerCtx, action)
+	cancel()
+	cancelTimeout()
+	if err != nil && action.IsCanceled() {
+		err = &canceledError{err: err}
+	}
+	outcome := actionOutcome{positionID: position.ID, err: err}
+	var holdTimer Timer
+	if err == nil {
+		e.positions.add(position)
+		if e.maxHoldDuration > 0 {
+			holdTimer = e.newTimer(e.maxHoldDuration)
+		}
+	}
 	closed1, closed2 := e.teePositionClosed(ctx.Done(), g, closed)
+	if err == nil && e.positionOpenedBeforeResult && e.onPositionOpened != nil {
+		e.onPositionOpened(position)
+	}
 	select {
 	case <-ctx.Done():
-		return nil
+		stopTimer(holdTimer)
+		return outcome, nil
 	case <-time.After(e.sendResultTimeout):
-		return fmt.Errorf("open position: %w", ErrSendResultTimeout)
+		stopTimer(holdTimer)
+		return outcome, &SendResultTimeoutError{Action: "open position", PositionID: position.ID}
 	case action.result <- OpenPositionActionResult{
 		Position: position,
 		Closed:   closed1,
@@ -551,67 +1305,170 @@ func (e *Engine) doOpenPosition(ctx context.Context, g *errgroup.Group, action O
 	}:
 	}
 	if err != nil {
-		return nil
+		return outcome, nil
 	}
 
 	g.Go(func() error {
+		e.trackPosition(ctx, position.ID, closed2, holdTimer)
+		return nil
+	})
+
+	if !e.positionOpenedBeforeResult && e.onPositionOpened != nil {
+		e.onPositionOpened(position)
+	}
+	return outcome, nil
+}
+
+// trackPosition waits for the position closing. If holdTimer fires earlier,
+// it closes the position through the running engine. The timer is stopped on return
+func (e *Engine) trackPosition(
+	ctx context.Context,
+	positionID PositionID,
+	closed PositionClosed,
+	holdTimer Timer,
+) {
+	var holdTimeout <-chan time.Time
+	if holdTimer != nil {
+		defer holdTimer.Stop()
+		holdTimeout = holdTimer.C()
+	}
+	for {
 		select {
 		case <-ctx.Done():
-			return nil
-		case position, ok := <-closed2:
+			return
+		case <-holdTimeout:
+			holdTimeout = nil
+			action := NewClosePositionAction(positionID)
+			if err := e.sendAction(ctx, action); err != nil {
+				return
+			}
+			if _, err := action.Result(ctx); err != nil && ctx.Err() == nil {
+				e.reportError(fmt.Errorf("close position %s by max hold duration: %w", positionID, err))
+			}
+		case position, ok := <-closed:
 			if !ok {
-				return nil
+				return
 			}
+			e.positions.remove(position.ID)
+			e.lossLimit.add(e.now(), position.Profit())
+			e.stats.add(position)
 			if e.onPositionClosed != nil {
 				e.onPositionClosed(position)
 			}
-			return nil
+			if e.onPositionClosedResult != nil {
+				e.onPositionClosedResult(NewPositionResult(position))
+			}
+			return
 		}
-	})
+	}
+}
 
-	if e.onPositionOpened != nil {
-		e.onPositionOpened(position)
+func stopTimer(timer Timer) {
+	if timer != nil {
+		timer.Stop()
 	}
-	return nil
 }
 
-func (e *Engine) doClosePosition(ctx context.Context, action ClosePositionAction) error {
-	position, err := e.broker.ClosePosition(ctx, action)
+// actionContext returns ctx for Broker limited by the action timeout or the engine default
+func (e *Engine) actionContext(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout <= 0 {
+		timeout = e.actionTimeout
+	}
+	if timeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, timeout)
+}
 
+func (e *Engine) reportError(err error) {
+	if e.onError != nil {
+		e.onError(err)
+	}
+}
+
+func (e *Engine) rejectOpenPosition(
+	ctx context.Context,
+	action OpenPositionAction,
+	err error,
+) (actionOutcome, error) {
+	outcome := actionOutcome{err: err}
 	select {
 	case <-ctx.Done():
+		return outcome, nil
+	case <-time.After(e.sendResultTimeout):
+		return outcome, &SendResultTimeoutError{Action: "open position"}
+	case action.result <- OpenPositionActionResult{error: err}:
+	}
+	return outcome, nil
+}
+
+// checkValidUntil returns ErrActionNotValid if validUntil is set and not in the future
+func (e *Engine) checkValidUntil(validUntil time.Time) error {
+	if validUntil.IsZero() || validUntil.After(e.now()) {
 		return nil
+	}
+	return fmt.Errorf("valid until %s is expired: %w", validUntil.Format(time.RFC3339), ErrActionNotValid)
+}
+
+func (e *Engine) doClosePosition(ctx context.Context, action ClosePositionAction) (actionOutcome, error) {
+	brokerCtx, cancel := e.actionContext(ctx, action.Timeout)
+	position, err := e.broker.ClosePosition(brokerCtx, action)
+	cancel()
+	outcome := actionOutcome{positionID: action.PositionID, err: err}
+	if err == nil {
+		e.positions.remove(action.PositionID)
+	}
+
+	select {
+	case <-ctx.Done():
+		return outcome, nil
 	case <-time.After(e.sendResultTimeout):
-		return fmt.Errorf("close position: %w", ErrSendResultTimeout)
+		return outcome, &SendResultTimeoutError{Action: "close position", PositionID: action.PositionID}
 	case action.result <- ClosePositionActionResult{
 		Position: position,
 		error:    err,
 	}:
 	}
-	return nil
+	return outcome, nil
 }
 
-func (e *Engine) doChangeConditionalOrder(ctx context.Context, action ChangeConditionalOrderAction) error {
-	position, err := e.broker.ChangeConditionalOrder(ctx, action)
+func (e *Engine) doChangeConditionalOrder(
+	ctx context.Context,
+	action ChangeConditionalOrderAction,
+) (actionOutcome, error) {
+	var position Position
+	err := ErrActionNotValid
+	if action.IsValid() {
+		err = e.checkValidUntil(action.ValidUntil)
+	}
+	if err == nil {
+		brokerCtx, cancel := e.actionContext(ctx, action.Timeout)
+		position, err = e.broker.ChangeConditionalOrder(brokerCtx, action)
+		cancel()
+		if err == nil {
+			e.positions.update(position)
+		}
+	}
+	outcome := actionOutcome{positionID: action.PositionID, err: err}
 
 	select {
 	case <-ctx.Done():
-		return nil
+		return outcome, nil
 	case <-time.After(e.sendResultTimeout):
-		return fmt.Errorf("change conditional order: %w", ErrSendResultTimeout)
+		return outcome, &SendResultTimeoutError{Action: "change conditional order", PositionID: action.PositionID}
 	case action.result <- ChangeConditionalOrderActionResult{
 		Position: position,
 		error:    err,
 	}:
 	}
 	if err != nil {
-		return nil
+		return outcome, nil
 	}
 
 	if e.onConditionalOrderChanged != nil {
 		e.onConditionalOrderChanged(position)
 	}
-	return nil
+	return outcome, nil
 }
 
 func (e *Engine) teePositionClosed(
@@ -619,8 +1476,14 @@ func (e *Engine) teePositionClosed(
 	g *errgroup.Group,
 	in PositionClosed,
 ) (PositionClosed, PositionClosed) {
-	out1 := make(chan Position)
-	out2 := make(chan Position)
+	// Buffered outputs do not let a consumer which does not read
+	// the closed position block delivery to the other one
+	size := e.positionClosedBuffer
+	if size <= 0 {
+		size = 1
+	}
+	out1 := make(chan Position, size)
+	out2 := make(chan Position, size)
 
 	g.Go(func() error {
 		defer close(out1)
@@ -44,6 +44,23 @@ func TestPositionType_Multiplier(t *testing.T) {
 	}
 }
 
+func TestNewPositionID(t *testing.T) {
+	t.Run("default", func(t *testing.T) {
+		assert.NotEqual(t, NewPositionID(), NewPositionID())
+	})
+
+	t.Run("generator", func(t *testing.T) {
+		id := uuid.MustParse("a7c3a8f1-3ef1-4e3c-9f4c-2a4a8c1d9b10")
+		positionID := NewPositionID(func() uuid.UUID { return id })
+		assert.Equal(t, PositionID(id), positionID)
+		assert.Equal(t, "a7c3a8f1-3ef1-4e3c-9f4c-2a4a8c1d9b10", positionID.String())
+	})
+
+	t.Run("nil generator", func(t *testing.T) {
+		assert.NotEqual(t, PositionID{}, NewPositionID(nil))
+	})
+}
+
 func TestPositionType_NewPosition(t *testing.T) {
 	tests := []struct {
 		name      string
@@ -68,6 +85,7 @@ func TestPositionType_NewPosition(t *testing.T) {
 				Quantity:         1,
 				StopLossOffset:   1,
 				TakeProfitOffset: 2,
+				Tag:              "breakout",
 				result:           make(chan OpenPositionActionResult),
 			},
 			openPrice: 10,
@@ -75,11 +93,13 @@ func TestPositionType_NewPosition(t *testing.T) {
 			want: &Position{
 				ID:         PositionID(uuid.New()),
 				Type:       Long,
+				Quantity:   1,
 				OpenTime:   time.Unix(1, 0),
 				OpenPrice:  10,
 				CloseTime:  time.Time{},
 				StopLoss:   9,
 				TakeProfit: 12,
+				Tag:        "breakout",
 			},
 			wantErr: nil,
 		},
@@ -97,6 +117,7 @@ func TestPositionType_NewPosition(t *testing.T) {
 			want: &Position{
 				ID:         PositionID(uuid.New()),
 				Type:       Short,
+				Quantity:   1,
 				OpenTime:   time.Unix(1, 0),
 				OpenPrice:  10,
 				CloseTime:  time.Time{},
@@ -114,12 +135,8 @@ func TestPositionType_NewPosition(t *testing.T) {
 				assert.Nil(t, position)
 				return
 			}
-			assert.Equal(t, tt.want.Type, position.Type)
-			assert.Equal(t, tt.want.OpenTime, position.OpenTime)
-			assert.Equal(t, tt.want.OpenPrice, position.OpenPrice)
-			assert.Equal(t, tt.want.CloseTime, position.CloseTime)
-			assert.Equal(t, tt.want.StopLoss, position.StopLoss)
-			assert.Equal(t, tt.want.TakeProfit, position.TakeProfit)
+			tt.want.ID = position.ID
+			assert.True(t, tt.want.EqualValue(*position), "got %+v", *position)
 		})
 	}
 }
@@ -199,6 +216,11 @@ func TestPosition_Profit(t *testing.T) {
 			position: Position{Type: Short, Quantity: 5, OpenPrice: 10, ClosePrice: 15},
 			want:     -25,
 		},
+		{
+			name:     "quantity=0 with commission",
+			position: Position{Type: Long, Quantity: 0, OpenPrice: 10, ClosePrice: 15, Commission: 1},
+			want:     0,
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -207,6 +229,75 @@ func TestPosition_Profit(t *testing.T) {
 	}
 }
 
+func TestPosition_ProfitRounded(t *testing.T) {
+	tests := []struct {
+		name     string
+		position Position
+		want     float64
+	}{
+		{
+			name:     "long",
+			position: Position{Type: Long, Quantity: 1, OpenPrice: 0.3, ClosePrice: 154.2},
+			want:     153.9,
+		},
+		{
+			name:     "short with commission",
+			position: Position{Type: Short, Quantity: 3, OpenPrice: 1.1, ClosePrice: 0.8, Commission: 0.015},
+			want:     0.89,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.NotEqual(t, tt.want, tt.position.Profit())
+			assert.Equal(t, tt.want, tt.position.ProfitRounded())
+		})
+	}
+}
+
+func TestPosition_ProfitInCurrency(t *testing.T) {
+	tests := []struct {
+		name     string
+		position Position
+		want     float64
+	}{
+		{
+			name: "futures long",
+			position: Position{
+				Type:       Long,
+				Quantity:   2,
+				OpenPrice:  100000,
+				ClosePrice: 100500,
+				PriceStep:  10,
+				StepPrice:  6.5,
+				Commission: 4,
+			},
+			want: 646,
+		},
+		{
+			name: "futures short",
+			position: Position{
+				Type:       Short,
+				Quantity:   1,
+				OpenPrice:  100000,
+				ClosePrice: 100500,
+				PriceStep:  10,
+				StepPrice:  6.5,
+			},
+			want: -325,
+		},
+		{
+			name:     "price step not set",
+			position: Position{Type: Long, Quantity: 2, OpenPrice: 10, ClosePrice: 15},
+			want:     10,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, tt.position.ProfitInCurrency())
+		})
+	}
+}
+
 func TestPosition_ProfitByPrice(t *testing.T) {
 	tests := []struct {
 		name     string
@@ -234,9 +325,158 @@ func TestPosition_ProfitByPrice(t *testing.T) {
 	}
 }
 
+func TestPosition_BreakEvenPrice(t *testing.T) {
+	long := Position{Type: Long, Quantity: 2, OpenPrice: 100, Commission: 1}
+	assert.Equal(t, 100.5, long.BreakEvenPrice())
+	assert.Equal(t, 0., long.ProfitByPrice(long.BreakEvenPrice())-long.Commission)
+
+	short := Position{Type: Short, Quantity: 2, OpenPrice: 100, Commission: 1}
+	assert.Equal(t, 99.5, short.BreakEvenPrice())
+	assert.Equal(t, 0., short.ProfitByPrice(short.BreakEvenPrice())-short.Commission)
+
+	withoutCommission := Position{Type: Long, Quantity: 1, OpenPrice: 100}
+	assert.Equal(t, 100., withoutCommission.BreakEvenPrice())
+}
+
+func TestPosition_conditionalOrderDistances(t *testing.T) {
+	tests := []struct {
+		name                   string
+		position               Position
+		wantStopLossDistance   float64
+		wantTakeProfitDistance float64
+		wantRiskAmount         float64
+		wantRewardAmount       float64
+	}{
+		{
+			name:                   "long",
+			position:               Position{Type: Long, Quantity: 2, OpenPrice: 100, StopLoss: 95, TakeProfit: 110},
+			wantStopLossDistance:   -5,
+			wantTakeProfitDistance: 10,
+			wantRiskAmount:         -10,
+			wantRewardAmount:       20,
+		},
+		{
+			name:                   "short",
+			position:               Position{Type: Short, Quantity: 3, OpenPrice: 100, StopLoss: 104, TakeProfit: 90},
+			wantStopLossDistance:   -4,
+			wantTakeProfitDistance: 10,
+			wantRiskAmount:         -12,
+			wantRewardAmount:       30,
+		},
+		{
+			name:     "not set",
+			position: Position{Type: Long, Quantity: 1, OpenPrice: 100},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.wantStopLossDistance, tt.position.StopLossDistance())
+			assert.Equal(t, tt.wantTakeProfitDistance, tt.position.TakeProfitDistance())
+			assert.Equal(t, tt.wantRiskAmount, tt.position.RiskAmount())
+			assert.Equal(t, tt.wantRewardAmount, tt.position.RewardAmount())
+		})
+	}
+}
+
+func TestPosition_Slippage(t *testing.T) {
+	tests := []struct {
+		name     string
+		position Position
+		want     float64
+	}{
+		{
+			name: "long filled worse than intended",
+			position: Position{
+				Type:               Long,
+				Quantity:           2,
+				OpenPrice:          101,
+				IntendedOpenPrice:  100,
+				ClosePrice:         108,
+				IntendedClosePrice: 110,
+			},
+			want: -6,
+		},
+		{
+			name: "short filled better than intended",
+			position: Position{
+				Type:               Short,
+				Quantity:           1,
+				OpenPrice:          101,
+				IntendedOpenPrice:  100,
+				ClosePrice:         90,
+				IntendedClosePrice: 91,
+			},
+			want: 2,
+		},
+		{
+			name:     "intended prices not set",
+			position: Position{Type: Long, Quantity: 1, OpenPrice: 101, ClosePrice: 108},
+			want:     0,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, tt.position.Slippage())
+		})
+	}
+}
+
 func TestPosition_UnitCommission(t *testing.T) {
 	position := Position{Commission: 250, Quantity: 2}
 	assert.Equal(t, position.UnitCommission(), 125.)
+
+	position = Position{Commission: 250, Quantity: 0}
+	assert.Equal(t, 0., position.UnitCommission())
+}
+
+func TestPosition_UnitProfit(t *testing.T) {
+	position := Position{Type: Long, Quantity: 2, OpenPrice: 10, ClosePrice: 15, Commission: 2}
+	assert.Equal(t, 4., position.UnitProfit())
+
+	position = Position{Type: Long, Quantity: 0, OpenPrice: 10, ClosePrice: 15, Commission: 2}
+	assert.Equal(t, 0., position.UnitProfit())
+	assert.Equal(t, 0., position.Profit())
+}
+
+func TestPosition_String(t *testing.T) {
+	id := uuid.MustParse("1f2e3d4c-0000-0000-0000-000000000000")
+	action := NewOpenPositionAction("FIGI", Long, 2, 0, 0)
+	position, err := NewPosition(action, time.Unix(1, 0), 100.5)
+	assert.NoError(t, err)
+	position.ID = PositionID(id)
+	assert.Equal(t, "1f2e3d4c long qty=2 open=100.5 state=open", position.String())
+
+	position.AddCommission(1)
+	assert.NoError(t, position.Close(time.Unix(2, 0), 110))
+	assert.Equal(t, "1f2e3d4c long qty=2 open=100.5 close=110 profit=18 state=closed", position.String())
+	assert.Equal(t, position.String(), fmt.Sprint(*position))
+}
+
+func TestPositionType_String(t *testing.T) {
+	assert.Equal(t, "long", Long.String())
+	assert.Equal(t, "short", Short.String())
+	assert.Equal(t, "unknown", PositionType(0).String())
+}
+
+func TestPosition_EqualValue(t *testing.T) {
+	action := NewOpenPositionAction("FIGI", Long, 2, 1, 2)
+	position, err := NewPosition(action, time.Unix(1, 0), 10)
+	assert.NoError(t, err)
+	position.SetExtra("key", "value")
+
+	other := *position
+	other.extraMtx = &sync.RWMutex{}
+	other.extra = make(map[interface{}]interface{})
+	other.closed = make(chan struct{})
+	other.OpenTime = time.Unix(1, 0).In(time.FixedZone("MSK", 3*60*60))
+	assert.True(t, position.EqualValue(other))
+
+	other.StopLoss = 8
+	assert.False(t, position.EqualValue(other))
+
+	other = *position
+	other.ID = NewPositionID()
+	assert.False(t, position.EqualValue(other))
 }
 
 func TestPosition_Duration(t *testing.T) {
@@ -282,6 +522,77 @@ func TestOpenPositionAction_IsValid(t *testing.T) {
 		action := OpenPositionAction{Type: Long, Quantity: 1}
 		assert.True(t, action.IsValid())
 	})
+
+	t.Run("negative trigger price", func(t *testing.T) {
+		action := OpenPositionAction{Type: Long, Quantity: 1, TriggerPrice: -1}
+		assert.False(t, action.IsValid())
+	})
+
+	t.Run("display quantity", func(t *testing.T) {
+		action := OpenPositionAction{Type: Long, Quantity: 10, DisplayQuantity: 2}
+		assert.True(t, action.IsValid())
+
+		action.DisplayQuantity = 11
+		assert.False(t, action.IsValid())
+
+		action.DisplayQuantity = -1
+		assert.False(t, action.IsValid())
+	})
+}
+
+func TestNewLongPositionAction(t *testing.T) {
+	action := NewLongPositionAction("FIGI", 2, 10, 20)
+	assert.Equal(t, Long, action.Type)
+	assert.Equal(t, "FIGI", action.FIGI)
+	assert.Equal(t, int64(2), action.Quantity)
+	assert.Equal(t, 10., action.StopLossOffset)
+	assert.Equal(t, 20., action.TakeProfitOffset)
+	assert.True(t, action.IsValid())
+}
+
+func TestNewShortPositionAction(t *testing.T) {
+	action := NewShortPositionAction("FIGI", 2, 10, 20)
+	assert.Equal(t, Short, action.Type)
+	assert.Equal(t, "FIGI", action.FIGI)
+	assert.Equal(t, int64(2), action.Quantity)
+	assert.Equal(t, 10., action.StopLossOffset)
+	assert.Equal(t, 20., action.TakeProfitOffset)
+	assert.True(t, action.IsValid())
+}
+
+func TestOpenPositionAction_IsStopEntry(t *testing.T) {
+	action := NewOpenPositionAction("FIGI", Long, 1, 0, 0)
+	assert.False(t, action.IsStopEntry())
+
+	action.TriggerPrice = 105
+	assert.True(t, action.IsStopEntry())
+	assert.True(t, action.IsValid())
+}
+
+func TestOpenPositionAction_Cancel(t *testing.T) {
+	action := NewOpenPositionAction("FIGI", Long, 1, 0, 0)
+	assert.False(t, action.IsCanceled())
+
+	action.Cancel()
+	assert.True(t, action.IsCanceled())
+
+	action.Cancel()
+	assert.True(t, action.IsCanceled())
+
+	action = OpenPositionAction{}
+	action.Cancel()
+	assert.False(t, action.IsCanceled())
+}
+
+func TestNewLimitClosePositionAction(t *testing.T) {
+	positionID := NewPositionID()
+	action := NewLimitClosePositionAction(positionID, 123.45)
+	assert.Equal(t, positionID, action.PositionID)
+	assert.Equal(t, 123.45, action.LimitPrice)
+	assert.NotNil(t, action.result)
+
+	action = NewClosePositionAction(positionID)
+	assert.Zero(t, action.LimitPrice)
 }
 
 func TestPosition_IsClosed(t *testing.T) {
@@ -300,6 +611,95 @@ func TestPosition_IsClosed(t *testing.T) {
 	})
 }
 
+func TestPosition_WaitClosed(t *testing.T) {
+	t.Run("closed", func(t *testing.T) {
+		position := Position{
+			closed:     make(chan struct{}),
+			closedOnce: &sync.Once{},
+		}
+		go func() {
+			assert.NoError(t, position.Close(time.Now(), 123))
+		}()
+		assert.NoError(t, position.WaitClosed(context.Background()))
+	})
+
+	t.Run("closed before", func(t *testing.T) {
+		position := Position{
+			closed:     make(chan struct{}),
+			closedOnce: &sync.Once{},
+		}
+		assert.NoError(t, position.Close(time.Now(), 123))
+		assert.NoError(t, position.WaitClosed(context.Background()))
+	})
+
+	t.Run("context canceled", func(t *testing.T) {
+		position := Position{closed: make(chan struct{})}
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		assert.ErrorIs(t, position.WaitClosed(ctx), context.Canceled)
+	})
+}
+
+func TestMergeClosed(t *testing.T) {
+	var inputs []PositionClosed
+	var channels []chan Position
+	for i := 0; i < 3; i++ {
+		c := make(chan Position)
+		channels = append(channels, c)
+		inputs = append(inputs, c)
+	}
+	inputs = append(inputs, nil)
+
+	merged := MergeClosed(context.Background(), inputs...)
+
+	want := make(map[PositionID]bool)
+	for _, c := range channels {
+		position := Position{ID: NewPositionID()}
+		want[position.ID] = true
+		c := c
+		go func() {
+			c <- position
+			close(c)
+		}()
+	}
+
+	got := make(map[PositionID]bool)
+	for position := range merged {
+		got[position.ID] = true
+	}
+	assert.Equal(t, want, got)
+}
+
+func TestMergeClosed_empty(t *testing.T) {
+	_, ok := <-MergeClosed(context.Background())
+	assert.False(t, ok)
+}
+
+func TestMergeClosed_consumerExited(t *testing.T) {
+	input := make(chan Position, 3)
+	for i := 0; i < 3; i++ {
+		input <- Position{ID: NewPositionID()}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	merged := MergeClosed(ctx, input)
+	<-merged
+	cancel()
+
+	assert.Eventually(t, func() bool {
+		for {
+			select {
+			case _, ok := <-merged:
+				if !ok {
+					return true
+				}
+			default:
+				return false
+			}
+		}
+	}, time.Second, 10*time.Millisecond)
+}
+
 func TestEngine_doOpenPosition(t *testing.T) {
 	broker := &MockBroker{}
 	position := Position{}
@@ -323,11 +723,11 @@ func TestEngine_doOpenPosition(t *testing.T) {
 
 	ctx, cancel := context.WithCancel(context.Background())
 	resultChan := make(chan OpenPositionActionResult, 1)
-	action := OpenPositionAction{result: resultChan}
-	broker.On("OpenPosition", ctx, action).Return(position, PositionClosed(positionClosed), nil)
+	action := OpenPositionAction{Type: Long, Quantity: 1, result: resultChan}
+	broker.On("OpenPosition", mock.Anything, action).Return(position, PositionClosed(positionClosed), nil)
 
 	g := &errgroup.Group{}
-	err := engine.doOpenPosition(ctx, g, action)
+	_, err := engine.doOpenPosition(ctx, g, action)
 	assert.Nil(t, err)
 	result := <-resultChan
 	assert.Equal(t, position, result.Position)
@@ -353,6 +753,417 @@ waitCalledLoop:
 	_ = g.Wait()
 }
 
+func TestEngine_doOpenPosition_positionOpenedBeforeResult(t *testing.T) {
+	tests := []struct {
+		name         string
+		beforeResult bool
+		want         []string
+	}{
+		{name: "default", beforeResult: false, want: []string{"result", "callback"}},
+		{name: "before result", beforeResult: true, want: []string{"callback", "result"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			broker := &MockBroker{}
+			engine := New(&MockStrategy{}, broker, WithPositionOpenedBeforeResult(tt.beforeResult))
+
+			var mtx sync.Mutex
+			var events []string
+			addEvent := func(event string) {
+				mtx.Lock()
+				defer mtx.Unlock()
+				events = append(events, event)
+			}
+			resultRead := make(chan struct{})
+			engine.OnPositionOpened(func(position Position) {
+				if !tt.beforeResult {
+					<-resultRead
+				}
+				addEvent("callback")
+			})
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			action := NewOpenPositionAction("FIGI", Long, 1, 0, 0)
+			broker.On("OpenPosition", mock.Anything, action).Return(Position{}, PositionClosed(make(chan Position)), nil)
+
+			var wg sync.WaitGroup
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				_, err := action.Result(ctx)
+				assert.NoError(t, err)
+				addEvent("result")
+				close(resultRead)
+			}()
+
+			_, err := engine.doOpenPosition(ctx, &errgroup.Group{}, action)
+			assert.NoError(t, err)
+			wg.Wait()
+			assert.Equal(t, tt.want, events)
+		})
+	}
+}
+
+func TestEngine_doOpenPosition_canceled(t *testing.T) {
+	broker := &MockBroker{}
+	engine := Engine{
+		broker:            broker,
+		sendResultTimeout: 5 * time.Second,
+	}
+
+	action := NewOpenPositionAction("FIGI", Long, 1, 0, 0)
+	action.Cancel()
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		result, err := action.Result(context.Background())
+		assert.ErrorIs(t, err, ErrActionCanceled)
+		assert.Equal(t, Position{}, result.Position)
+	}()
+
+	_, err := engine.doOpenPosition(context.Background(), &errgroup.Group{}, action)
+	assert.Nil(t, err)
+	wg.Wait()
+	broker.AssertNotCalled(t, "OpenPosition", mock.Anything, mock.Anything)
+}
+
+func TestEngine_doOpenPosition_canceledInBroker(t *testing.T) {
+	broker := &MockBroker{}
+	engine := Engine{
+		broker:            broker,
+		sendResultTimeout: 5 * time.Second,
+	}
+
+	action := NewOpenPositionAction("FIGI", Long, 1, 0, 0)
+	opening := make(chan struct{})
+	broker.On("OpenPosition", mock.Anything, action).Run(func(args mock.Arguments) {
+		close(opening)
+		<-args.Get(0).(context.Context).Done()
+	}).Return(Position{}, PositionClosed(nil), context.Canceled)
+
+	go func() {
+		<-opening
+		action.Cancel()
+	}()
+
+	_, err := engine.doOpenPosition(context.Background(), &errgroup.Group{}, action)
+	assert.Nil(t, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	_, err = action.Result(ctx)
+	assert.ErrorIs(t, err, ErrActionCanceled)
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.EqualError(t, err, "action canceled: context canceled")
+	broker.AssertExpectations(t)
+}
+
+func TestEngine_doOpenPosition_notValid(t *testing.T) {
+	broker := &MockBroker{}
+	engine := New(&MockStrategy{}, broker)
+
+	action := NewOpenPositionAction("FIGI", PositionType(5), 1, 0, 0)
+	_, err := engine.doOpenPosition(context.Background(), &errgroup.Group{}, action)
+	assert.NoError(t, err)
+	_, err = action.Result(context.Background())
+	assert.ErrorIs(t, err, ErrActionNotValid)
+	broker.AssertNotCalled(t, "OpenPosition", mock.Anything, mock.Anything)
+}
+
+func TestChangeConditionalOrderAction_IsValid(t *testing.T) {
+	action := ChangeConditionalOrderAction{StopLoss: 90, ClearTakeProfit: true}
+	assert.True(t, action.IsValid())
+
+	action = ChangeConditionalOrderAction{StopLoss: 90, ClearStopLoss: true}
+	assert.False(t, action.IsValid())
+
+	action = ChangeConditionalOrderAction{TakeProfit: 110, ClearTakeProfit: true}
+	assert.False(t, action.IsValid())
+}
+
+func TestEngine_doChangeConditionalOrder_clear(t *testing.T) {
+	broker := &MockBroker{}
+	engine := New(&MockStrategy{}, broker)
+	ctx := context.Background()
+
+	action := NewChangeConditionalOrderAction(NewPositionID(), 0, 0)
+	action.ClearTakeProfit = true
+	position := Position{ID: action.PositionID, StopLoss: 90}
+	broker.On("ChangeConditionalOrder", mock.Anything, mock.MatchedBy(func(a ChangeConditionalOrderAction) bool {
+		return a.ClearTakeProfit && !a.ClearStopLoss && a.StopLoss == 0
+	})).Return(position, nil).Once()
+	_, err := engine.doChangeConditionalOrder(ctx, action)
+	assert.NoError(t, err)
+	result, err := action.Result(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, 90., result.Position.StopLoss)
+	assert.Equal(t, 0., result.Position.TakeProfit)
+
+	action = NewChangeConditionalOrderAction(NewPositionID(), 0, 120)
+	action.ClearTakeProfit = true
+	_, err = engine.doChangeConditionalOrder(ctx, action)
+	assert.NoError(t, err)
+	_, err = action.Result(ctx)
+	assert.ErrorIs(t, err, ErrActionNotValid)
+	broker.AssertNumberOfCalls(t, "ChangeConditionalOrder", 1)
+}
+
+func TestEngine_validUntil(t *testing.T) {
+	broker := &MockBroker{}
+	clock := newFakeClock(time.Unix(100, 0))
+	engine := New(&MockStrategy{}, broker, WithClock(clock))
+	ctx := context.Background()
+
+	openAction := NewOpenPositionAction("FIGI", Long, 1, 0, 0)
+	openAction.ValidUntil = time.Unix(100, 0)
+	_, err := engine.doOpenPosition(ctx, &errgroup.Group{}, openAction)
+	assert.NoError(t, err)
+	_, err = openAction.Result(ctx)
+	assert.ErrorIs(t, err, ErrActionNotValid)
+
+	changeAction := NewChangeConditionalOrderAction(NewPositionID(), 90, 0)
+	changeAction.ValidUntil = time.Unix(99, 0)
+	_, err = engine.doChangeConditionalOrder(ctx, changeAction)
+	assert.NoError(t, err)
+	_, err = changeAction.Result(ctx)
+	assert.ErrorIs(t, err, ErrActionNotValid)
+	broker.AssertNotCalled(t, "OpenPosition", mock.Anything, mock.Anything)
+	broker.AssertNotCalled(t, "ChangeConditionalOrder", mock.Anything, mock.Anything)
+
+	changeAction = NewChangeConditionalOrderAction(NewPositionID(), 90, 0)
+	changeAction.ValidUntil = time.Unix(101, 0)
+	position := Position{ID: changeAction.PositionID, StopLoss: 90}
+	broker.On("ChangeConditionalOrder", mock.Anything, changeAction).Return(position, nil)
+	_, err = engine.doChangeConditionalOrder(ctx, changeAction)
+	assert.NoError(t, err)
+	result, err := changeAction.Result(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, position, result.Position)
+}
+
+func TestEngine_doOpenPosition_maxHoldDuration(t *testing.T) {
+	broker := &MockBroker{}
+	clock := newFakeClock(time.Unix(100, 0))
+	engine := New(&MockStrategy{}, broker, WithClock(clock), WithMaxHoldDuration(time.Hour))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	g := &errgroup.Group{}
+	actions := make(Actions)
+	control := engine.setRunning(ctx.Done())
+	g.Go(func() error {
+		return engine.run(ctx, g, actions, control)
+	})
+
+	position := Position{ID: NewPositionID(), Type: Long, Quantity: 1}
+	positionClosed := make(chan Position, 1)
+	action := NewOpenPositionAction("FIGI", Long, 1, 0, 0)
+	broker.On("OpenPosition", mock.Anything, action).Return(position, PositionClosed(positionClosed), nil)
+	broker.On("ClosePosition", mock.Anything, mock.MatchedBy(func(a ClosePositionAction) bool {
+		return a.PositionID == position.ID
+	})).Run(func(args mock.Arguments) {
+		positionClosed <- position
+		close(positionClosed)
+	}).Return(position, nil)
+
+	assert.NoError(t, engine.sendAction(ctx, action))
+	result, err := action.Result(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, position, result.Position)
+
+	clock.Add(59 * time.Minute)
+	time.Sleep(50 * time.Millisecond)
+	broker.AssertNotCalled(t, "ClosePosition", mock.Anything, mock.Anything)
+
+	clock.Add(time.Minute)
+	assert.Eventually(t, func() bool {
+		return len(engine.OpenPositions()) == 0
+	}, time.Second, 10*time.Millisecond)
+	broker.AssertNumberOfCalls(t, "ClosePosition", 1)
+
+	cancel()
+	_ = g.Wait()
+}
+
+func TestEngine_doOpenPosition_maxHoldDurationAlreadyClosed(t *testing.T) {
+	broker := &MockBroker{}
+	clock := newFakeClock(time.Unix(100, 0))
+	reportedErr := make(chan error, 1)
+	engine := New(&MockStrategy{}, broker, WithClock(clock), WithMaxHoldDuration(time.Hour),
+		WithOnError(func(err error) {
+			reportedErr <- err
+		}))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	g := &errgroup.Group{}
+	actions := make(Actions)
+	control := engine.setRunning(ctx.Done())
+	g.Go(func() error {
+		return engine.run(ctx, g, actions, control)
+	})
+
+	position := Position{ID: NewPositionID(), Type: Long, Quantity: 1}
+	positionClosed := make(chan Position, 1)
+	broker.On("OpenPosition", mock.Anything, mock.Anything).Return(position, PositionClosed(positionClosed), nil)
+	// The stop loss is triggered at the same time as the max hold duration elapses
+	broker.On("ClosePosition", mock.Anything, mock.MatchedBy(func(a ClosePositionAction) bool {
+		return a.PositionID == position.ID
+	})).Run(func(args mock.Arguments) {
+		positionClosed <- position
+		close(positionClosed)
+	}).Return(Position{}, ErrAlreadyClosed)
+
+	_, err := actions.OpenPosition(ctx, "FIGI", Long, 1, 0, 0)
+	assert.NoError(t, err)
+
+	clock.Add(time.Hour)
+	select {
+	case err := <-reportedErr:
+		assert.ErrorIs(t, err, ErrAlreadyClosed)
+	case <-time.After(time.Second):
+		assert.Fail(t, "error is not reported")
+	}
+	assert.Eventually(t, func() bool {
+		return len(engine.OpenPositions()) == 0
+	}, time.Second, 10*time.Millisecond)
+
+	otherID := NewPositionID()
+	broker.On("ClosePosition", mock.Anything, mock.MatchedBy(func(a ClosePositionAction) bool {
+		return a.PositionID == otherID
+	})).Return(Position{ID: otherID}, nil)
+	_, err = actions.ClosePosition(ctx, otherID)
+	assert.NoError(t, err)
+
+	cancel()
+	assert.ErrorIs(t, g.Wait(), context.Canceled)
+}
+
+func TestEngine_doOpenPosition_maxHoldDurationStopped(t *testing.T) {
+	broker := &MockBroker{}
+	clock := newFakeClock(time.Unix(100, 0))
+	engine := New(&MockStrategy{}, broker, WithClock(clock), WithMaxHoldDuration(time.Hour))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	g := &errgroup.Group{}
+	actions := make(Actions)
+	control := engine.setRunning(ctx.Done())
+	g.Go(func() error {
+		return engine.run(ctx, g, actions, control)
+	})
+
+	position := Position{ID: NewPositionID(), Type: Long, Quantity: 1}
+	positionClosed := make(chan Position, 1)
+	action := NewOpenPositionAction("FIGI", Long, 1, 0, 0)
+	broker.On("OpenPosition", mock.Anything, action).Return(position, PositionClosed(positionClosed), nil)
+
+	assert.NoError(t, engine.sendAction(ctx, action))
+	_, err := action.Result(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, clock.pendingTimers())
+
+	positionClosed <- position
+	assert.Eventually(t, func() bool {
+		return clock.pendingTimers() == 0
+	}, time.Second, 10*time.Millisecond)
+	assert.Empty(t, engine.OpenPositions())
+	broker.AssertNotCalled(t, "ClosePosition", mock.Anything, mock.Anything)
+
+	cancel()
+	_ = g.Wait()
+}
+
+func TestEngine_doOpenPosition_delayedResultRead(t *testing.T) {
+	broker := &MockBroker{}
+	engine := Engine{
+		broker:            broker,
+		sendResultTimeout: 50 * time.Millisecond,
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	position := Position{ID: NewPositionID()}
+	action := NewOpenPositionAction("FIGI", Long, 1, 0, 0)
+	broker.On("OpenPosition", mock.Anything, action).Return(position, PositionClosed(make(chan Position)), nil)
+
+	g := &errgroup.Group{}
+	_, err := engine.doOpenPosition(ctx, g, action)
+	assert.NoError(t, err)
+
+	time.Sleep(100 * time.Millisecond)
+	result, err := action.Result(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, position, result.Position)
+
+	cancel()
+	_ = g.Wait()
+}
+
+func TestEngine_doOpenPosition_timeout(t *testing.T) {
+	broker := &MockBroker{}
+	engine := New(&MockStrategy{}, broker, WithActionTimeout(10*time.Millisecond))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	position := Position{ID: NewPositionID()}
+	action := NewOpenPositionActionWithTimeout("FIGI", Long, 1, 0, 0, time.Second)
+	broker.On("OpenPosition", mock.Anything, action).Run(func(args mock.Arguments) {
+		select {
+		case <-args.Get(0).(context.Context).Done():
+			assert.Fail(t, "broker context is done before the action timeout")
+		case <-time.After(50 * time.Millisecond):
+		}
+	}).Return(position, PositionClosed(make(chan Position)), nil)
+
+	g := &errgroup.Group{}
+	_, err := engine.doOpenPosition(ctx, g, action)
+	assert.NoError(t, err)
+	result, err := action.Result(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, position, result.Position)
+
+	cancel()
+	_ = g.Wait()
+}
+
+func TestEngine_doClosePosition_timeout(t *testing.T) {
+	broker := &MockBroker{}
+	engine := New(&MockStrategy{}, broker, WithActionTimeout(10*time.Millisecond))
+
+	action := NewClosePositionAction(NewPositionID())
+	broker.On("ClosePosition", mock.Anything, action).Return(func(ctx context.Context, _ ClosePositionAction) Position {
+		<-ctx.Done()
+		return Position{}
+	}, func(ctx context.Context, _ ClosePositionAction) error {
+		return ctx.Err()
+	})
+
+	_, err := engine.doClosePosition(context.Background(), action)
+	assert.NoError(t, err)
+	_, err = action.Result(context.Background())
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+}
+
+func TestEngine_actionContext(t *testing.T) {
+	engine := Engine{}
+	ctx, cancel := engine.actionContext(context.Background(), 0)
+	_, ok := ctx.Deadline()
+	assert.False(t, ok)
+	cancel()
+	assert.Error(t, ctx.Err())
+
+	engine.actionTimeout = time.Hour
+	ctx, cancel = engine.actionContext(context.Background(), time.Minute)
+	defer cancel()
+	deadline, ok := ctx.Deadline()
+	assert.True(t, ok)
+	assert.WithinDuration(t, time.Now().Add(time.Minute), deadline, time.Second)
+}
+
 func TestEngine_doClosePosition(t *testing.T) {
 	broker := &MockBroker{}
 	position := Position{}
@@ -365,15 +1176,46 @@ func TestEngine_doClosePosition(t *testing.T) {
 	defer cancel()
 	resultChan := make(chan ClosePositionActionResult, 1)
 	action := ClosePositionAction{result: resultChan}
-	broker.On("ClosePosition", ctx, action).Return(position, nil)
+	broker.On("ClosePosition", mock.Anything, action).Return(position, nil)
 
-	err := engine.doClosePosition(ctx, action)
+	_, err := engine.doClosePosition(ctx, action)
 	assert.Nil(t, err)
 	result := <-resultChan
 	assert.Equal(t, position, result.Position)
 	assert.Nil(t, result.error)
 }
 
+func TestEngine_doClosePosition_sendResultTimeout(t *testing.T) {
+	broker := &MockBroker{}
+	engine := Engine{
+		broker:            broker,
+		sendResultTimeout: 10 * time.Millisecond,
+	}
+
+	positionID := NewPositionID()
+	action := ClosePositionAction{PositionID: positionID, result: make(chan ClosePositionActionResult)}
+	broker.On("ClosePosition", mock.Anything, action).Return(Position{ID: positionID}, nil)
+
+	_, err := engine.doClosePosition(context.Background(), action)
+	assert.ErrorIs(t, err, ErrSendResultTimeout)
+	assert.Contains(t, err.Error(), positionID.String())
+
+	var timeoutErr *SendResultTimeoutError
+	assert.ErrorAs(t, err, &timeoutErr)
+	assert.Equal(t, positionID, timeoutErr.PositionID)
+	assert.Equal(t, "close position", timeoutErr.Action)
+}
+
+func TestSendResultTimeoutError_Error(t *testing.T) {
+	err := &SendResultTimeoutError{Action: "open position"}
+	assert.Equal(t, "open position: send result timeout", err.Error())
+
+	positionID := NewPositionID()
+	err = &SendResultTimeoutError{Action: "change conditional order", PositionID: positionID}
+	assert.Equal(t, "change conditional order "+positionID.String()+": send result timeout", err.Error())
+	assert.ErrorIs(t, err, ErrSendResultTimeout)
+}
+
 func TestEngine_doChangeConditionalOrder(t *testing.T) {
 	broker := &MockBroker{}
 	position := Position{}
@@ -392,9 +1234,9 @@ func TestEngine_doChangeConditionalOrder(t *testing.T) {
 	defer cancel()
 	resultChan := make(chan ChangeConditionalOrderActionResult, 1)
 	action := ChangeConditionalOrderAction{result: resultChan}
-	broker.On("ChangeConditionalOrder", ctx, action).Return(position, nil)
+	broker.On("ChangeConditionalOrder", mock.Anything, action).Return(position, nil)
 
-	err := engine.doChangeConditionalOrder(ctx, action)
+	_, err := engine.doChangeConditionalOrder(ctx, action)
 	assert.Nil(t, err)
 	result := <-resultChan
 	assert.Equal(t, position, result.Position)
@@ -480,3 +1322,391 @@ func TestEngine_Run(t *testing.T) {
 		wg.Wait()
 	})
 }
+
+func TestEngine_run_openAfterPendingClose(t *testing.T) {
+	broker := &MockBroker{}
+	engine := New(&MockStrategy{}, broker)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	g := &errgroup.Group{}
+	actions := make(Actions)
+	g.Go(func() error {
+		return engine.run(ctx, g, actions, nil)
+	})
+
+	var closeDone atomic.Bool
+	closeAction := NewClosePositionAction(NewPositionID())
+	broker.On("ClosePosition", mock.Anything, closeAction).
+		Run(func(args mock.Arguments) {
+			time.Sleep(50 * time.Millisecond)
+			closeDone.Store(true)
+		}).
+		Return(Position{ID: closeAction.PositionID}, nil)
+
+	openAction := NewOpenPositionAction("FIGI", Long, 1, 0, 0)
+	broker.On("OpenPosition", mock.Anything, openAction).
+		Run(func(args mock.Arguments) {
+			assert.True(t, closeDone.Load())
+		}).
+		Return(Position{ID: NewPositionID()}, PositionClosed(make(chan Position)), nil)
+
+	actions <- closeAction
+	actions <- openAction
+
+	_, err := openAction.Result(ctx)
+	assert.NoError(t, err)
+	_, err = closeAction.Result(ctx)
+	assert.NoError(t, err)
+	broker.AssertExpectations(t)
+
+	cancel()
+	assert.ErrorIs(t, g.Wait(), context.Canceled)
+}
+
+func TestEngine_run_drainActions(t *testing.T) {
+	broker := &MockBroker{}
+	var reportedErr error
+	engine := New(&MockStrategy{}, broker, WithOnError(func(err error) {
+		reportedErr = err
+	}))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	actions := make(Actions, 3)
+	openAction := NewOpenPositionAction("FIGI", Long, 1, 0, 0)
+	closeAction := NewClosePositionAction(NewPositionID())
+	actions <- openAction
+	actions <- closeAction
+	actions <- "unknown action"
+
+	assert.ErrorIs(t, engine.run(ctx, &errgroup.Group{}, actions, nil), context.Canceled)
+
+	resultCtx, resultCancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer resultCancel()
+	_, err := openAction.Result(resultCtx)
+	assert.ErrorIs(t, err, context.Canceled)
+	_, err = closeAction.Result(resultCtx)
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.NoError(t, resultCtx.Err())
+	assert.EqualError(t, reportedErr, "3 actions drained on shutdown: context canceled")
+	assert.Empty(t, actions)
+	broker.AssertNotCalled(t, "OpenPosition", mock.Anything, mock.Anything)
+	broker.AssertNotCalled(t, "ClosePosition", mock.Anything, mock.Anything)
+}
+
+func TestEngine_run_notStrictActions(t *testing.T) {
+	broker := &MockBroker{}
+
+	var reportedErr error
+	engine := New(&MockStrategy{}, broker, WithStrictActions(false), WithOnError(func(err error) {
+		reportedErr = err
+	}))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	g := &errgroup.Group{}
+	actions := make(Actions)
+	g.Go(func() error {
+		return engine.run(ctx, g, actions, nil)
+	})
+
+	actions <- "unknown action"
+
+	position := Position{ID: NewPositionID()}
+	broker.On("ClosePosition", mock.Anything, mock.Anything).Return(position, nil)
+	result, err := actions.ClosePosition(ctx, position.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, position, result.Position)
+	assert.ErrorIs(t, reportedErr, ErrUnknownAction)
+
+	cancel()
+	assert.ErrorIs(t, g.Wait(), context.Canceled)
+}
+
+func TestEngine_callbacksAfterStart(t *testing.T) {
+	strategy := &MockStrategy{}
+	started := make(chan struct{})
+	strategy.On("Run", mock.Anything, mock.Anything).Run(func(args mock.Arguments) {
+		close(started)
+		<-args.Get(0).(context.Context).Done()
+	}).Return(context.Canceled)
+	engine := New(strategy, &MockBroker{})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		_ = engine.Run(ctx)
+	}()
+	<-started
+
+	assert.Panics(t, func() { engine.OnPositionOpened(func(position Position) {}) })
+	assert.Panics(t, func() { engine.OnConditionalOrderChanged(func(position Position) {}) })
+	assert.Panics(t, func() { engine.OnPositionClosed(func(position Position) {}) })
+	assert.Panics(t, func() { engine.OnPositionClosedResult(func(result PositionResult) {}) })
+
+	cancel()
+	wg.Wait()
+	assert.NotPanics(t, func() { engine.OnPositionOpened(func(position Position) {}) })
+}
+
+func TestEngine_RunWithActions(t *testing.T) {
+	broker := &MockBroker{}
+	engine := New(nil, broker)
+	actions := make(Actions)
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		assert.NoError(t, engine.RunWithActions(context.Background(), actions))
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	position := Position{ID: NewPositionID()}
+	broker.On("OpenPosition", mock.Anything, mock.Anything).
+		Return(position, PositionClosed(make(chan Position)), nil).Once()
+	result, err := actions.OpenPosition(ctx, "FIGI", Long, 1, 0, 0)
+	assert.NoError(t, err)
+	assert.Equal(t, position, result.Position)
+
+	broker.On("ClosePosition", mock.Anything, mock.Anything).Return(position, nil).Once()
+	_, err = actions.ClosePosition(ctx, position.ID)
+	assert.NoError(t, err)
+	broker.AssertExpectations(t)
+
+	close(actions)
+	wg.Wait()
+}
+
+func TestEngine_teePositionClosed(t *testing.T) {
+	t.Run("consumer never reads", func(t *testing.T) {
+		engine := Engine{}
+		done := make(chan struct{})
+		defer close(done)
+		g := &errgroup.Group{}
+		in := make(chan Position)
+
+		_, out2 := engine.teePositionClosed(done, g, in)
+
+		position := Position{ID: NewPositionID()}
+		in <- position
+		close(in)
+
+		select {
+		case val := <-out2:
+			assert.Equal(t, position, val)
+		case <-time.After(time.Second):
+			assert.Fail(t, "position not received")
+			return
+		}
+		select {
+		case _, ok := <-out2:
+			assert.False(t, ok)
+		case <-time.After(time.Second):
+			assert.Fail(t, "output not closed")
+		}
+		assert.NoError(t, g.Wait())
+	})
+
+	t.Run("both consumers read", func(t *testing.T) {
+		engine := Engine{}
+		done := make(chan struct{})
+		defer close(done)
+		g := &errgroup.Group{}
+		in := make(chan Position)
+
+		out1, out2 := engine.teePositionClosed(done, g, in)
+
+		position := Position{ID: NewPositionID()}
+		in <- position
+		close(in)
+		assert.Equal(t, position, <-out1)
+		assert.Equal(t, position, <-out2)
+		assert.NoError(t, g.Wait())
+	})
+
+	t.Run("rapid closes with buffer", func(t *testing.T) {
+		const count = 5
+		engine := New(&MockStrategy{}, &MockBroker{}, WithPositionClosedBuffer(count))
+		done := make(chan struct{})
+		defer close(done)
+		g := &errgroup.Group{}
+		in := make(chan Position)
+
+		out1, out2 := engine.teePositionClosed(done, g, in)
+
+		sent := make(chan struct{})
+		go func() {
+			defer close(sent)
+			for i := 0; i < count; i++ {
+				in <- Position{ID: NewPositionID(), Quantity: int64(i)}
+			}
+			close(in)
+		}()
+		select {
+		case <-sent:
+		case <-time.After(time.Second):
+			assert.Fail(t, "positions not sent")
+			return
+		}
+
+		assert.NoError(t, g.Wait())
+		for _, out := range []PositionClosed{out1, out2} {
+			var quantities []int64
+			for position := range out {
+				quantities = append(quantities, position.Quantity)
+			}
+			assert.Equal(t, []int64{0, 1, 2, 3, 4}, quantities)
+		}
+	})
+}
+
+type protectionMonitorBroker struct {
+	*MockBroker
+	handler func(position Position)
+}
+
+func (b *protectionMonitorBroker) SetProtectionLostHandler(f func(position Position)) {
+	b.handler = f
+}
+
+func TestEngine_Run_onProtectionLost(t *testing.T) {
+	broker := &protectionMonitorBroker{MockBroker: &MockBroker{}}
+	position := Position{ID: NewPositionID(), StopLoss: 90}
+
+	strategy := &MockStrategy{}
+	strategy.On("Run", mock.Anything, mock.Anything).Run(func(args mock.Arguments) {
+		broker.handler(position)
+	}).Return(nil)
+
+	var lost []Position
+	engine := New(strategy, broker)
+	engine.OnProtectionLost(func(p Position) {
+		lost = append(lost, p)
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	assert.ErrorIs(t, engine.Run(ctx), context.Canceled)
+	assert.Equal(t, []Position{position}, lost)
+}
+
+type errorReporterBroker struct {
+	*MockBroker
+	handler func(err error)
+}
+
+func (b *errorReporterBroker) SetErrorHandler(f func(err error)) {
+	b.handler = f
+}
+
+func TestEngine_Run_onError(t *testing.T) {
+	strategy := &MockStrategy{}
+	broker := &errorReporterBroker{MockBroker: &MockBroker{}}
+
+	var reportedErrs []error
+	var mtx sync.Mutex
+	engine := New(strategy, broker, WithOnError(func(err error) {
+		mtx.Lock()
+		defer mtx.Unlock()
+		reportedErrs = append(reportedErrs, err)
+	}))
+
+	cancelStopOrderErr := errors.New("cancel stop order")
+	position := Position{ID: NewPositionID()}
+	broker.On("ClosePosition", mock.Anything, mock.Anything).Run(func(args mock.Arguments) {
+		broker.handler(cancelStopOrderErr)
+	}).Return(position, nil)
+	broker.On("ChangeConditionalOrder", mock.Anything, mock.Anything).Return(position, nil)
+
+	strategy.On("Run", mock.Anything, mock.Anything).Run(func(args mock.Arguments) {
+		ctx := args.Get(0).(context.Context)
+		actions := args.Get(1).(Actions)
+
+		_, err := actions.ClosePosition(ctx, position.ID)
+		assert.NoError(t, err)
+
+		_, err = actions.ChangeConditionalOrder(ctx, position.ID, 1, 2)
+		assert.NoError(t, err)
+		close(actions)
+		<-ctx.Done()
+	}).Return(nil)
+
+	assert.NoError(t, engine.Run(context.Background()))
+	broker.AssertCalled(t, "ChangeConditionalOrder", mock.Anything, mock.Anything)
+	assert.Equal(t, []error{cancelStopOrderErr}, reportedErrs)
+}
+
+func TestEngine_run_continueOnActionError(t *testing.T) {
+	broker := &MockBroker{}
+
+	var reportedErr error
+	engine := New(&MockStrategy{}, broker, WithContinueOnActionError(true), WithOnError(func(err error) {
+		reportedErr = err
+	}))
+	engine.sendResultTimeout = 10 * time.Millisecond
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	g := &errgroup.Group{}
+	actions := make(Actions)
+	g.Go(func() error {
+		return engine.run(ctx, g, actions, nil)
+	})
+
+	// The action is not created by the constructor, so it has no result channel
+	// and sending of the result fails
+	failedAction := OpenPositionAction{Type: Long, Quantity: 1}
+	broker.On("OpenPosition", mock.Anything, failedAction).
+		Return(Position{}, PositionClosed(nil), errors.New("open position"))
+	actions <- failedAction
+
+	position := Position{ID: NewPositionID()}
+	broker.On("ClosePosition", mock.Anything, mock.Anything).Return(position, nil)
+	result, err := actions.ClosePosition(ctx, position.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, position, result.Position)
+	assert.ErrorIs(t, reportedErr, ErrSendResultTimeout)
+
+	cancel()
+	assert.ErrorIs(t, g.Wait(), context.Canceled)
+}
+
+func TestEngine_run_brokerError(t *testing.T) {
+	broker := &MockBroker{}
+	var reportedErr error
+	engine := New(&MockStrategy{}, broker, WithOnError(func(err error) {
+		reportedErr = err
+	}))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	g := &errgroup.Group{}
+	actions := make(Actions)
+	g.Go(func() error {
+		return engine.run(ctx, g, actions, nil)
+	})
+
+	brokerErr := errors.New("close position")
+	failedID, position := NewPositionID(), Position{ID: NewPositionID()}
+	broker.On("ClosePosition", mock.Anything, mock.MatchedBy(func(a ClosePositionAction) bool {
+		return a.PositionID == failedID
+	})).Return(Position{}, brokerErr)
+	broker.On("ClosePosition", mock.Anything, mock.MatchedBy(func(a ClosePositionAction) bool {
+		return a.PositionID == position.ID
+	})).Return(position, nil)
+
+	_, err := actions.ClosePosition(ctx, failedID)
+	assert.ErrorIs(t, err, brokerErr)
+	result, err := actions.ClosePosition(ctx, position.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, position, result.Position)
+	assert.NoError(t, reportedErr)
+
+	cancel()
+	assert.ErrorIs(t, g.Wait(), context.Canceled)
+}